@@ -0,0 +1,115 @@
+package gomr
+
+import (
+	"fmt"
+	"github.com/mitchellh/goamz/s3"
+	"io"
+	"net/http"
+)
+
+//BlobStore defines the storage used for job binaries, job data, map outputs and results.
+//
+//Keys are slash separated paths like bin/<sha256> or <prefix>/<job>/maps/<partition>-<uuid>.
+//Implementations are S3 and a local directory tree, selected through Environment.GetBlobStore.
+type BlobStore interface {
+	Put(key string, r io.Reader, length int64, contenttype string) error //Store length bytes read from r under key
+	Get(key string) ([]byte, error)                                      //Retrieve contents of key
+	GetReader(key string) (io.ReadCloser, error)                         //Retrieve contents of key as a stream
+	GetRange(key string, start, end int64) (io.ReadCloser, error)        //Retrieve bytes start up to end (exclusive) of key as a stream, end -1 reads to the end
+	Size(key string) (int64, error)                                      //Length of the contents of key
+	Exists(key string) (bool, error)                                     //Check if key exists without fetching it
+	List(prefix string) ([]string, error)                                //List all keys starting with prefix
+	Delete(key string) error                                             //Remove key, removing a missing key is not an error
+}
+
+//Stores blobs in an S3 bucket
+type S3BlobStore struct {
+	bucket *s3.Bucket
+}
+
+func NewS3BlobStore(bucket *s3.Bucket) *S3BlobStore {
+	return &S3BlobStore{bucket}
+}
+
+func (b *S3BlobStore) Put(key string, r io.Reader, length int64, contenttype string) error {
+	return b.bucket.PutReader(key, r, length, contenttype, s3.Private)
+}
+
+func (b *S3BlobStore) Get(key string) ([]byte, error) {
+	return b.bucket.Get(key)
+}
+
+func (b *S3BlobStore) GetReader(key string) (io.ReadCloser, error) {
+	return b.bucket.GetReader(key)
+}
+
+func (b *S3BlobStore) GetRange(key string, start, end int64) (io.ReadCloser, error) {
+	if start == 0 && end < 0 {
+		return b.GetReader(key)
+	}
+	byterange := fmt.Sprintf("bytes=%d-", start)
+	if end >= 0 {
+		if end <= start {
+			return emptyreader{}, nil
+		}
+		byterange = fmt.Sprintf("bytes=%d-%d", start, end-1)
+	}
+	resp, err := b.bucket.GetResponseWithHeaders(key, map[string][]string{"Range": {byterange}})
+	if err != nil {
+		return nil, err
+	}
+	//A server ignoring the range sends the object from the start, which callers would take for the range
+	if resp.StatusCode != http.StatusPartialContent {
+		resp.Body.Close()
+		return nil, fmt.Errorf("Unexpected status %d fetching %s", resp.StatusCode, key)
+	}
+	return resp.Body, nil
+}
+
+func (b *S3BlobStore) Size(key string) (int64, error) {
+	k, err := b.bucket.GetKey(key)
+	if err != nil {
+		return 0, err
+	}
+	return k.Size, nil
+}
+
+func (b *S3BlobStore) Exists(key string) (bool, error) {
+	_, err := b.bucket.GetKey(key)
+	if err != nil {
+		if s3err, ok := err.(*s3.Error); ok && s3err.StatusCode == 404 {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func (b *S3BlobStore) List(prefix string) ([]string, error) {
+	keys := []string{}
+	marker := ""
+	for {
+		resp, err := b.bucket.List(prefix, "", marker, 1000)
+		if err != nil {
+			return keys, err
+		}
+		for _, k := range resp.Contents {
+			keys = append(keys, k.Key)
+		}
+		if !resp.IsTruncated || len(resp.Contents) == 0 {
+			return keys, nil
+		}
+		//Without a delimiter S3 does not return NextMarker, the last key is the marker
+		marker = resp.Contents[len(resp.Contents)-1].Key
+	}
+}
+
+func (b *S3BlobStore) Delete(key string) error {
+	return b.bucket.Del(key)
+}
+
+//Reader for empty ranges
+type emptyreader struct{}
+
+func (emptyreader) Read(p []byte) (int, error) { return 0, io.EOF }
+func (emptyreader) Close() error               { return nil }
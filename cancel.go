@@ -0,0 +1,49 @@
+package gomr
+
+import (
+	"sync/atomic"
+)
+
+//Cancel a job by name. Workers stop claiming its tasks and drop running ones at their next heartbeat
+func CancelJob(jobname string) error {
+	return canceljob(NewEnvironment(), jobname)
+}
+
+func canceljob(env *Environment, jobname string) error {
+	co, err := env.GetCoordinator()
+	if err != nil {
+		return err
+	}
+	defer co.Close()
+	return co.CancelJob(jobname)
+}
+
+//Cancel this job in the environment it lives in, e.g. that of its LocalRunner
+func (j *Job) Cancel() error {
+	return canceljob(j.environment(), j.Name)
+}
+
+//Whether the job got cancelled while the current task runs. Long running Map and Reduce
+//functions should check this now and then and return early, their output is discarded anyway
+func (j *Job) Cancelled() bool {
+	return atomic.LoadInt32(&j.cancelled) == 1
+}
+
+func (j *Job) cancel() {
+	atomic.StoreInt32(&j.cancelled, 1)
+}
+
+//Returns ErrJobFailed or ErrJobCancelled if no more tasks of the job should be started
+func checkjob(co Coordinator, jobname string) error {
+	info, err := co.GetJob(jobname)
+	if err != nil {
+		return err
+	}
+	switch info.Status {
+	case StatusFail:
+		return ErrJobFailed
+	case StatusCancelled:
+		return ErrJobCancelled
+	}
+	return nil
+}
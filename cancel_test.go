@@ -0,0 +1,78 @@
+package gomr
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestHeartbeatCancelledJob(t *testing.T) {
+	c := newtestcoordinator(t)
+	ok, err := c.ClaimTask("job", StageMap, 0, "input", "a", testttl)
+	if err != nil || !ok {
+		t.Fatalf("Claim failed: %v %v", ok, err)
+	}
+	j := &Job{Name: "job"}
+	hb := startheartbeat(c, j, "job", StageMap, 0, "a", testttl, NewConsoleLog(nil))
+	err = c.CancelJob("job")
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(testttl)
+	if !j.Cancelled() {
+		t.Error("Job not flagged as cancelled")
+	}
+	if err = hb.stop(); err != ErrJobCancelled {
+		t.Errorf("Got %v, want ErrJobCancelled", err)
+	}
+	if err = checkjob(c, "job"); err != ErrJobCancelled {
+		t.Errorf("Got %v, want ErrJobCancelled", err)
+	}
+	if c.CancelJob("job") != nil {
+		t.Error("Cancelling twice failed")
+	}
+}
+
+func TestCancelledJobTasksArentClaimed(t *testing.T) {
+	dir, inputs := testinputs(t, "a\n", "b\n", "c\n")
+	defer os.RemoveAll(dir)
+	maps, reduces := 0, 0
+	w := &Worker{
+		Map: func(input string, job *Job, logger Logger) (map[int]string, error) {
+			maps++
+			err := job.Cancel()
+			if err != nil {
+				return nil, err
+			}
+			return nil, errors.New("cancelled")
+		},
+		Reduce: func(inputs []string, partition int, job *Job, logger Logger) (string, error) {
+			reduces++
+			return "", nil
+		},
+	}
+	job := &Job{Inputs: inputs, Partitions: 1}
+	r := &LocalRunner{Worker: w, Dir: filepath.Join(dir, "store")}
+	_, err := runlocal(t, r, job)
+	if err != ErrJobCancelled {
+		t.Fatalf("Got %v, want ErrJobCancelled", err)
+	}
+	//Another worker coming along doesn't pick up the job either
+	env := job.environment()
+	w.execute(env, job.Name)
+	if maps != 1 || reduces != 0 {
+		t.Errorf("Ran %d maps and %d reduces after cancelling", maps, reduces)
+	}
+	tasks, err := env.memory.ListTasks(job.Name, StageMap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tasks) != 1 {
+		t.Errorf("Claimed %d map tasks, want 1", len(tasks))
+	}
+	if job.Cancel() != nil {
+		t.Error("Cancelling twice failed")
+	}
+}
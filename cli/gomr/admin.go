@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"github.com/turbobytes/gomr"
+	"log"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+)
+
+func gc(args []string) {
+	fs := newflagset("gc", "")
+	policy := gomr.GCPolicy{}
+	fs.BoolVar(&policy.DeleteIntermediate, "intermediate", true, "Delete map outputs of finished jobs")
+	fs.DurationVar(&policy.MaxAge, "maxage", 0, "Delete finished jobs older than this e.g. 720h, 0 keeps them")
+	fs.BoolVar(&policy.DeleteBinaries, "binaries", false, "Delete binaries no job refers to, don't use while submitting jobs")
+	fs.Parse(args)
+	err := gomr.GC(policy)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Println("Done")
+}
+
+func worker(args []string) {
+	fs := newflagset("worker", "")
+	d := &gomr.WorkerDaemon{}
+	fs.DurationVar(&d.Interval, "interval", gomr.DefaultInterval, "How often to look for work if etcd can't be watched")
+	fs.DurationVar(&d.Fallback, "fallback", gomr.DefaultFallbackPoll, "How often to look for work while watching etcd, to catch tasks whose retry backoff expired")
+	fs.IntVar(&d.Slots, "slots", runtime.NumCPU(), "How many tasks run at once")
+	fs.DurationVar(&d.Report, "report", time.Minute, "How often slot utilisation is logged")
+	fs.Parse(args)
+	d.Run()
+}
+
+func workers(args []string) {
+	fs := newflagset("workers", "[jobname]")
+	fs.Parse(args)
+	switch fs.NArg() {
+	case 0:
+		infos, err := gomr.ListWorkers()
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, w := range infos {
+			fmt.Printf("%s\t%s\t%s\t%s/%s\t%d/%d slots busy\tstarted %s\theartbeat %s\n", w.ID, w.Hostname, w.Version, w.GOOS, w.GOARCH, w.Busy, w.Slots, w.StartedAt.Format(time.RFC3339), w.Heartbeat.Format(time.RFC3339))
+		}
+	case 1:
+		jobworkers, err := gomr.JobWorkers(fs.Arg(0))
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, jw := range jobworkers {
+			host := "unregistered"
+			if jw.Info != nil {
+				host = jw.Info.Hostname
+			}
+			fmt.Printf("%s\t%s\t%s\n", jw.ID, host, strings.Join(jw.Tasks, " "))
+		}
+	default:
+		fs.Usage()
+		os.Exit(2)
+	}
+}
+
+func migrateetcd(args []string) {
+	env := gomr.NewEnvironment()
+	fs := newflagset("migrate-etcd", "")
+	v2servers := fs.String("v2", strings.Join(env.ETCD_SERVERS, ","), "Comma separated list of etcd servers to read the v2 keyspace from")
+	v3servers := fs.String("v3", strings.Join(env.ETCD_SERVERS, ","), "Comma separated list of etcd servers to write the v3 keyspace to")
+	fs.Parse(args)
+	log.Println("Migrating jobs from etcd v2 to v3, make sure no workers are running...")
+	jobs, err := gomr.MigrateEtcdV2ToV3(strings.Split(*v2servers, ","), strings.Split(*v3servers, ","))
+	for _, job := range jobs {
+		fmt.Println("Migrated:", job)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println("Done, set COORDINATOR=etcdv3 on workers and clients")
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/turbobytes/gomr"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func submit(args []string) {
+	fs := newflagset("submit", "")
+	specfile := fs.String("spec", "", "Job spec file (YAML or JSON) describing the whole job, other flags are ignored")
+	binary := fs.String("binary", "", "Path to the job binary")
+	pkg := fs.String("build", "", "Go package or file to build the job binary from instead of -binary")
+	inputsfile := fs.String("inputs", "-", "File listing the map inputs one per line, - for stdin")
+	j := &gomr.Job{}
+	fs.StringVar(&j.NamePrefix, "prefix", "", "Job name prefix, single word, only alphanumeric")
+	fs.IntVar(&j.Partitions, "partitions", 1, "Number of partitions")
+	fs.StringVar(&j.S3Bucket, "bucket", "", "Bucket for binary, job data and outputs. Defaults to S3_BUCKET")
+	fs.StringVar(&j.S3Prefix, "s3prefix", "", "Prefix of job data and outputs inside the bucket")
+	fs.Int64Var(&j.SplitSize, "splitsize", 0, "Target bytes per map task, large inputs are split and small ones grouped. 0 for one map task per input")
+	fs.StringVar(&j.OutputFormat, "output", "", "Format of the results: tsv (default), csv, jsonl or records")
+	params := fs.String("params", "", "Job parameters as a JSON object")
+	attempts := fs.Int("attempts", 1, "Attempts per task")
+	fs.Parse(args)
+	if *specfile != "" {
+		spec, err := gomr.LoadJobSpec(*specfile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		name, err := spec.Deploy()
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(name)
+		return
+	}
+	if (*binary == "") == (*pkg == "") {
+		log.Fatal("Exactly one of -binary and -build is required")
+	}
+	if *params != "" {
+		err := json.Unmarshal([]byte(*params), &j.Params)
+		if err != nil {
+			log.Fatal("Invalid -params: ", err)
+		}
+	}
+	if *attempts > 1 {
+		j.Retry = &gomr.RetryPolicy{MaxAttempts: *attempts, Backoff: 10 * time.Second}
+	}
+	var err error
+	j.Inputs, err = gomr.ReadInputsFile(*inputsfile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(j.Inputs) == 0 {
+		log.Fatal("No inputs")
+	}
+	bin := *binary
+	if *pkg != "" {
+		bin, err = gomr.BuildBinary(*pkg)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer os.RemoveAll(filepath.Dir(bin))
+	}
+	name, err := j.Deploy(bin)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(name)
+}
+
+func printstatus(j *gomr.Job) {
+	fmt.Println("Job:", j.Name)
+	fmt.Println("Status:", gomr.StatusText(j.Status))
+	fmt.Println("Created:", j.CreatedAt)
+	for _, stage := range []struct {
+		name     string
+		progress *gomr.StageProgress
+	}{{"Map", j.MapProgress}, {"Reduce", j.ReduceProgress}} {
+		p := stage.progress
+		fmt.Printf("%s: %d total, %d waiting, %d running, %d done, %d failed\n", stage.name, p.Total, p.Waiting, p.Running, p.Done, p.Failed)
+	}
+	if j.Status == gomr.StatusFail {
+		fmt.Println("Failed task:", j.FailedTask)
+		fmt.Println("Reason:", j.FailReason)
+	}
+	for _, result := range j.Results {
+		fmt.Println("Result:", result)
+	}
+}
+
+func status(args []string) {
+	fs := newflagset("status", "<jobname>")
+	fs.Parse(args)
+	j := &gomr.Job{Name: jobnamearg(fs)}
+	err := j.UpdateStatus()
+	if err != nil {
+		log.Fatal(err)
+	}
+	printstatus(j)
+	workers, err := gomr.JobWorkers(j.Name)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, jw := range workers {
+		fmt.Println("Worker:", jw.ID, strings.Join(jw.Tasks, " "))
+	}
+}
+
+func list(args []string) {
+	fs := newflagset("list", "")
+	fs.Parse(args)
+	jobs, err := gomr.FetchAllJobs()
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, j := range jobs {
+		fmt.Printf("%s\t%s\t%s\n", j.Name, gomr.StatusText(j.Status), j.CreatedAt.Format(time.RFC3339))
+	}
+}
+
+//Whether the job will not change anymore
+func finished(status int) bool {
+	return status == gomr.StatusDone || status == gomr.StatusFail || status == gomr.StatusCancelled
+}
+
+func watch(args []string) {
+	fs := newflagset("watch", "<jobname>")
+	interval := fs.Duration("interval", 5*time.Second, "How often to check")
+	fs.Parse(args)
+	j := &gomr.Job{Name: jobnamearg(fs)}
+	last := ""
+	for {
+		err := j.UpdateStatus()
+		if err != nil {
+			log.Fatal(err)
+		}
+		m, r := j.MapProgress, j.ReduceProgress
+		line := fmt.Sprintf("%s map %d/%d (%d running, %d failed) reduce %d/%d (%d running, %d failed)",
+			gomr.StatusText(j.Status), m.Done, m.Total, m.Running, m.Failed, r.Done, r.Total, r.Running, r.Failed)
+		if line != last {
+			fmt.Println(time.Now().Format("15:04:05"), line)
+			last = line
+		}
+		if finished(j.Status) {
+			break
+		}
+		time.Sleep(*interval)
+	}
+	if j.Status == gomr.StatusFail {
+		fmt.Println("Failed task:", j.FailedTask)
+		fmt.Println("Reason:", j.FailReason)
+		os.Exit(1)
+	}
+}
+
+func logs(args []string) {
+	fs := newflagset("logs", "<jobname>")
+	n := fs.Int("n", 50, "Number of lines")
+	fs.Parse(args)
+	jobname := jobnamearg(fs)
+	env := gomr.NewEnvironment()
+	logger := env.GetLogger([]string{})
+	defer logger.Close()
+	for _, line := range logger.Fetch(jobname, *n) {
+		fmt.Printf("%s %s %s %s\n", line.TimeStamp.Format(time.RFC3339), line.Level, line.Hostname, line.Text)
+	}
+}
+
+func fetch(args []string) {
+	fs := newflagset("fetch", "<jobname>")
+	fname := fs.String("o", "", "Where to store the results")
+	format := fs.String("format", "", "Convert the results to tsv, csv, jsonl or records instead of storing them as the job wrote them")
+	header := fs.String("header", "", "Comma separated names of the key and value columns written as first row, csv and tsv only")
+	dir := fs.String("dir", "", "Store each partition in its own file in this directory instead of -o. Partitions already there are skipped, so an interrupted fetch can be resumed")
+	parts := fs.String("partitions", "", "Only fetch these partitions, e.g. 0,3-5")
+	fs.Parse(args)
+	jobname := jobnamearg(fs)
+	if (*fname == "") == (*dir == "") {
+		log.Fatal("Exactly one of -o and -dir is required")
+	}
+	if *dir != "" && (*format != "" || *header != "") {
+		log.Fatal("-format and -header only work with -o")
+	}
+	partitions, err := parsepartitions(*parts)
+	if err != nil {
+		log.Fatal(err)
+	}
+	j, err := gomr.FetchJob(jobname)
+	if err != nil {
+		log.Fatal(err)
+	}
+	switch j.Status {
+	case gomr.StatusDone:
+	case gomr.StatusFail:
+		log.Fatal("Job failed at task ", j.FailedTask, ": ", j.FailReason)
+	case gomr.StatusCancelled:
+		log.Fatal("Job was cancelled")
+	default:
+		log.Fatal("Job not finished")
+	}
+	if *dir != "" {
+		files, err := j.FetchPartitions(*dir, partitions)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println("Results fetched:", len(files), "partitions in", *dir)
+		return
+	}
+	if *format != "" || *header != "" || len(partitions) > 0 {
+		var columns []string
+		if *header != "" {
+			columns = strings.Split(*header, ",")
+		}
+		if *format == "" {
+			*format = j.OutputFormat
+		}
+		err = j.FetchResultsAs(*fname, *format, columns, partitions)
+	} else {
+		err = j.FetchResults(*fname)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println("Results fetched:", *fname)
+}
+
+//Parse a list of partitions like 0,3-5
+func parsepartitions(s string) ([]int, error) {
+	partitions := []int{}
+	if s == "" {
+		return partitions, nil
+	}
+	for _, part := range strings.Split(s, ",") {
+		bounds := strings.SplitN(part, "-", 2)
+		first, err := strconv.Atoi(bounds[0])
+		if err != nil {
+			return nil, fmt.Errorf("Invalid partitions '%s'", s)
+		}
+		last := first
+		if len(bounds) == 2 {
+			last, err = strconv.Atoi(bounds[1])
+			if err != nil || last < first {
+				return nil, fmt.Errorf("Invalid partitions '%s'", s)
+			}
+		}
+		for p := first; p <= last; p++ {
+			partitions = append(partitions, p)
+		}
+	}
+	return partitions, nil
+}
+
+func cancel(args []string) {
+	fs := newflagset("cancel", "<jobname>")
+	fs.Parse(args)
+	jobname := jobnamearg(fs)
+	err := gomr.CancelJob(jobname)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println("Job cancelled:", jobname)
+}
+
+func del(args []string) {
+	fs := newflagset("delete", "<jobname>")
+	fs.Parse(args)
+	jobname := jobnamearg(fs)
+	err := gomr.DeleteJob(jobname)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println("Job deleted:", jobname)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+type command struct {
+	name  string
+	usage string
+	run   func(args []string)
+}
+
+var commands = []command{
+	{"submit", "Deploy a job binary and submit a job", submit},
+	{"status", "Show status and progress of a job", status},
+	{"list", "List all jobs", list},
+	{"watch", "Follow progress of a job until it finishes", watch},
+	{"logs", "Show recent logs of a job", logs},
+	{"fetch", "Download results of a finished job", fetch},
+	{"cancel", "Cancel a job", cancel},
+	{"delete", "Delete a finished job and everything it stored", del},
+	{"gc", "Clean up intermediate outputs, old jobs and unused binaries", gc},
+	{"worker", "Run the worker daemon", worker},
+	{"workers", "List registered workers, or those running tasks of a job", workers},
+	{"migrate-etcd", "Copy jobs from the etcd v2 keyspace to v3", migrateetcd},
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: gomr <command> [flags] [jobname]")
+	fmt.Fprintln(os.Stderr, "")
+	fmt.Fprintln(os.Stderr, "Commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-13s %s\n", cmd.name, cmd.usage)
+	}
+	fmt.Fprintln(os.Stderr, "")
+	fmt.Fprintln(os.Stderr, "Run gomr <command> -h for the flags of a command. Configuration is read from the environment, see README.md")
+	os.Exit(2)
+}
+
+//Flags of a subcommand
+func newflagset(name, args string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: gomr %s [flags] %s\n", name, args)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+//The jobname argument of a subcommand
+func jobnamearg(fs *flag.FlagSet) string {
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	return fs.Arg(0)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	for _, cmd := range commands {
+		if cmd.name == os.Args[1] {
+			cmd.run(os.Args[2:])
+			return
+		}
+	}
+	usage()
+}
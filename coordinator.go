@@ -0,0 +1,122 @@
+package gomr
+
+import (
+	"errors"
+	"path"
+	"strconv"
+	"time"
+)
+
+//Stage names used for task coordination
+const (
+	StageMap    = "map"
+	StageReduce = "reduce"
+)
+
+//Coordinator owns the shared state workers use to agree on who does what.
+//
+//Locking semantics: ClaimTask is the only lock primitive. Exactly one caller succeeds in
+//claiming a given task, everyone else gets false and must leave the task alone. A claim is
+//a lease held by an owner ID for ttl, the owner must keep calling RenewTask while working on
+//the task. A task stays StatusInitialized until its owner calls CompleteTask, if the lease
+//expires before that the task can be claimed again by somebody else. An owner whose attempt
+//failed either gives the task up for a retry with ReleaseTask or marks it failed for good with FailTask.
+//Tasks that are StatusDone or StatusFail can not be claimed.
+//
+//Implementations are etcd (v2 and v3 API) and an in-memory one, selected through Environment.GetCoordinator.
+type Coordinator interface {
+	CreateJob(info *JobInfo) error                                                                             //Register a new job, fails if it already exists
+	GetJob(jobname string) (*JobInfo, error)                                                                   //Retrieve job metadata
+	ListJobs() ([]string, error)                                                                               //Names of all known jobs
+	DeleteJob(jobname string) error                                                                            //Remove the job and all its tasks, not an error if it doesn't exist
+	SetJobStatus(jobname string, status int) error                                                             //Update job status, ErrJobFailed or ErrJobCancelled if the job already failed or was cancelled
+	CancelJob(jobname string) error                                                                            //Mark the job StatusCancelled, fails if it is already done or failed
+	FailJob(jobname, reason, task string) error                                                                //Mark the job StatusFail, recording why and which task caused it. ErrJobFailed or ErrJobCancelled if the job already failed or was cancelled
+	SetNumReduces(jobname string, n int) error                                                                 //Update number of reduce tasks, known once map stage is done
+	ClaimTask(jobname, stage string, id int, input, owner string, ttl time.Duration) (bool, error)             //Try to lease a task for owner, input is recorded for map tasks
+	RenewTask(jobname, stage string, id int, owner string, ttl time.Duration) error                            //Extend the lease, ErrLostLease if owner no longer holds it
+	CompleteTask(jobname, stage string, id int, owner string, outputs map[int]string) error                    //Store outputs and mark the task StatusDone, ErrLostLease if owner no longer holds it
+	ReleaseTask(jobname, stage string, id int, owner string, attempt *TaskAttempt, retryafter time.Time) error //Record a failed attempt and give up the lease, the task can be claimed again after retryafter
+	FailTask(jobname, stage string, id int, owner string, attempt *TaskAttempt) error                          //Record a failed attempt and mark the task StatusFail
+	GetTask(jobname, stage string, id int) (*TaskInfo, error)                                                  //Retrieve a task, nil if it has not been claimed yet
+	ListTasks(jobname, stage string) ([]*TaskInfo, error)                                                      //All claimed tasks of a stage
+	Results(jobname string) (map[int]string, error)                                                            //Reduce outputs keyed by partition
+	RegisterWorker(info *WorkerInfo, ttl time.Duration) error                                                  //Add or refresh a worker daemon, it is dropped unless registered again within ttl
+	ListWorkers() ([]*WorkerInfo, error)                                                                       //Registered worker daemons, sorted by ID
+	Watch(stop <-chan struct{}) (<-chan struct{}, error)                                                       //Signals whenever tasks may have become claimable until stop is closed, see wakesworkers. The channel is closed once the watch ends
+	Close()
+}
+
+//Whether a change to a coordinator key may let workers claim tasks. prev is the value before
+//the change, nil if the key didn't exist. Work becomes claimable when a job is created, a task
+//goes back to StatusInitialized, the number of reduce tasks is set once the map stage is done
+//and leases are released or vanish because their owner stopped renewing them. Claims rewrite
+//the status of their task and other changes only move work along, they wake nobody.
+//Expired retry backoffs don't change anything, workers have to poll for those
+func wakesworkers(key, value string, prev *string, deleted bool) bool {
+	base := path.Base(key)
+	if deleted {
+		return base == "lease" || base == "lock"
+	}
+	initialized := strconv.Itoa(StatusInitialized)
+	switch {
+	case base == "status" && path.Dir(path.Dir(key)) == "/gomr":
+		//Job status
+		return prev == nil
+	case base == "status":
+		return value == initialized && prev != nil && *prev != initialized
+	case base == "numreduces":
+		return value != "0"
+	}
+	return false
+}
+
+//Non-blocking send, a pending signal is as good as a second one
+func signal(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+//Job metadata kept by the Coordinator. The full Job lives in the BlobStore as jobdata.json
+type JobInfo struct {
+	Name       string
+	Status     int       //StatusInitialized or StatusMapStage or StatusReduceStage or StatusFail or StatusDone or StatusCancelled
+	Binary     string    //BlobStore key of the gzipped job binary
+	S3Bucket   string    //Bucket holding binary, job data and outputs
+	S3Prefix   string    //Prefix of job data and outputs inside the bucket
+	CreatedAt  time.Time //Timestamp of when the Job was initially submitted
+	NumMaps    int       //Number of map tasks
+	NumReduces int       //Number of reduce tasks - 0 until all maps have finished
+	FailReason string    //Why the job failed, if it did
+	FailedTask string    //Task that made the job fail, as <stage>/<id>
+}
+
+//Coordination state of a single map or reduce task
+type TaskInfo struct {
+	ID         int
+	Status     int            //StatusInitialized while running, StatusDone once finished, StatusFail once out of retries
+	Owner      string         //Owner ID of the last claim
+	Leased     bool           //Whether the claim is still alive. StatusInitialized tasks without a lease are up for grabs
+	Attempts   []*TaskAttempt //Failed attempts, oldest first
+	RetryAfter time.Time      //Released tasks can't be claimed before this
+	Input      string         //Input of a map task
+	Outputs    map[int]string //Outputs keyed by partition. For map tasks these are the inputs of the reduce stage
+}
+
+//Returned when a task lease expired and somebody else may have claimed it
+var ErrLostLease = errors.New("Task lease lost")
+
+//Returned when trying to change the status of a failed job
+var ErrJobFailed = errors.New("Job has failed")
+
+//Returned when trying to change the status of a cancelled job
+var ErrJobCancelled = errors.New("Job was cancelled")
+
+//Sort tasks by ID
+type tasksbyid []*TaskInfo
+
+func (a tasksbyid) Len() int           { return len(a) }
+func (a tasksbyid) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a tasksbyid) Less(i, j int) bool { return a[i].ID < a[j].ID }
@@ -0,0 +1,42 @@
+package gomr
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestWakesWorkers(t *testing.T) {
+	initialized := strconv.Itoa(StatusInitialized)
+	done := strconv.Itoa(StatusDone)
+	mapstage := strconv.Itoa(StatusMapStage)
+	zero := "0"
+	tests := []struct {
+		name    string
+		key     string
+		value   string
+		prev    *string
+		deleted bool
+		wake    bool
+	}{
+		{"new job", "/gomr/job/status", initialized, nil, false, true},
+		{"job stage", "/gomr/job/status", mapstage, &initialized, false, false},
+		{"job deleted", "/gomr/job/status", "", &mapstage, true, false},
+		{"first claim", "/gomr/job/map/0/status", initialized, nil, false, false},
+		{"claim", "/gomr/job/map/0/status", initialized, &initialized, false, false},
+		{"task done", "/gomr/job/map/0/status", done, &initialized, false, false},
+		{"task reset", "/gomr/job/map/0/status", initialized, &done, false, true},
+		{"lease taken", "/gomr/job/map/0/lease", "owner", nil, false, false},
+		{"lease released", "/gomr/job/map/0/lease", "", nil, true, true},
+		{"lock released", "/gomr/job/map/0/lock", "", nil, true, true},
+		{"reduces created", "/gomr/job/numreduces", "0", nil, false, false},
+		{"reduces set", "/gomr/job/numreduces", "3", &zero, false, true},
+		{"owner", "/gomr/job/map/0/owner", "owner", nil, false, false},
+		{"retry after", "/gomr/job/map/0/retryafter", "2017-01-01T00:00:00Z", nil, false, false},
+	}
+	for _, test := range tests {
+		wake := wakesworkers(test.key, test.value, test.prev, test.deleted)
+		if wake != test.wake {
+			t.Errorf("%s: got %v, want %v", test.name, wake, test.wake)
+		}
+	}
+}
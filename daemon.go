@@ -0,0 +1,389 @@
+package gomr
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path"
+	"runtime"
+	"sync"
+	"time"
+)
+
+//Where downloaded job binaries are cached
+func bindir() string {
+	return os.TempDir() + "/gomrbin"
+}
+
+//Download the job binary unless it is cached already, returns its local path
+func (t *Task) fetchbinary() (string, error) {
+	dir := bindir()
+	err := os.MkdirAll(dir, 0776)
+	if err != nil {
+		return "", err
+	}
+	bin := dir + "/" + path.Base(t.Binary)
+	_, err = os.Stat(bin)
+	if err == nil {
+		return bin, nil
+	}
+	if !os.IsNotExist(err) {
+		return "", err
+	}
+	log.Println("Downloading binary from blob store")
+	env := NewEnvironment()
+	store, err := env.GetBlobStore(t.BucketName)
+	if err != nil {
+		return "", err
+	}
+	raw, err := store.Get(t.Binary)
+	if err != nil {
+		return "", err
+	}
+	//Uncompress the contents
+	rd, err := gzip.NewReader(bytes.NewReader(raw))
+	if err != nil {
+		return "", err
+	}
+	defer rd.Close()
+	//Write to a temporary name first so a half written binary is never run.
+	//Other slots may be downloading the same binary
+	f, err := ioutil.TempFile(dir, path.Base(bin)+".tmp")
+	if err != nil {
+		return "", err
+	}
+	_, err = io.Copy(f, rd)
+	if err == nil {
+		err = f.Chmod(0700)
+	}
+	f.Close()
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return bin, os.Rename(f.Name(), bin)
+}
+
+//Run the job binary for this task, downloading it first if needed
+func (t *Task) Run() error {
+	log.Println("TASK", t.Binary, t.JobName, t.BucketName)
+	bin, err := t.fetchbinary()
+	if err != nil {
+		return err
+	}
+	//Now execute...
+	cmd := exec.Command(bin, t.JobName)
+	if t.worker != "" {
+		cmd.Env = append(os.Environ(), workerenv+"="+t.worker)
+	}
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+//Tasks of the current stage of a job that could be claimed right now
+func waitingtasks(co Coordinator, info *JobInfo) (int, error) {
+	samples, err := co.ListTasks(info.Name, StageSample)
+	if err != nil {
+		return 0, err
+	}
+	for _, task := range samples {
+		if task.Status == StatusInitialized {
+			//Map tasks wait for the split points
+			if task.Leased {
+				return 0, nil
+			}
+			return 1, nil
+		}
+	}
+	now := time.Now()
+	stage, total := StageMap, info.NumMaps
+	for {
+		tasks, err := co.ListTasks(info.Name, stage)
+		if err != nil {
+			return 0, err
+		}
+		//Tasks nobody claimed yet aren't listed
+		waiting, running, finished := total-len(tasks), 0, 0
+		for _, task := range tasks {
+			switch {
+			case task.Status == StatusDone || task.Status == StatusFail:
+				finished++
+			case task.Leased:
+				running++
+			case task.RetryAfter.After(now):
+				//Backing off
+			default:
+				waiting++
+			}
+		}
+		if stage == StageMap && finished == total {
+			stage, total = StageReduce, info.NumReduces
+			continue
+		}
+		if finished == total {
+			//Somebody has to move the job on to the next stage
+			return 1, nil
+		}
+		return waiting, nil
+	}
+}
+
+//How often a WorkerDaemon polls for work if it can't watch the coordinator
+const DefaultInterval = 5 * time.Second
+
+//How often a WorkerDaemon watching the coordinator still polls for work
+const DefaultFallbackPoll = 30 * time.Second
+
+//Shortest time between two looks for work triggered by changes or freed slots, so bursts of
+//changes and binaries exiting right away don't keep the daemon busy
+const rescheduledelay = time.Second
+
+//Worker daemon running the binaries of incomplete jobs in several slots at once. Each slot
+//runs one job binary, which works on tasks of its job until there are none left to claim.
+//Slots are spread over jobs, a job gets at most as many as it has tasks waiting.
+//
+//The daemon watches the coordinator to pick up new jobs, released tasks and stage transitions
+//as they happen, and also looks for work when a slot becomes free. Polling is only a fallback.
+type WorkerDaemon struct {
+	Slots    int           //Optional - How many job binaries run at once. Defaults to the number of CPUs
+	Interval time.Duration //Optional - How often to look for work and try to watch again if the coordinator can't be watched. Defaults to DefaultInterval
+	Fallback time.Duration //Optional - How often to look for work while watching the coordinator, which misses expiring retry backoffs. Defaults to DefaultFallbackPoll
+	Report   time.Duration //Optional - How often slot utilisation is logged. Defaults to one minute
+	ID       string        //Set by Run. The daemon registers under this ID, tasks it runs have owners starting with it
+
+	started  time.Time
+	freed    chan struct{} //Signalled when a slot becomes free
+	mu       sync.Mutex
+	running  map[string]int //Busy slots per job
+	busy     int
+	busytime time.Duration //Slot time spent running binaries since the last report
+	last     time.Time     //When busytime was last updated
+	reported time.Time
+}
+
+//Snapshot of a WorkerDaemon's slots
+type SlotStats struct {
+	Slots       int
+	Busy        int
+	Jobs        map[string]int //Busy slots per job
+	Utilisation float64        //Fraction of slot time spent running binaries since the last report
+}
+
+//Add the slot time since the last update. d.mu must be held
+func (d *WorkerDaemon) account(now time.Time) {
+	d.busytime += time.Duration(d.busy) * now.Sub(d.last)
+	d.last = now
+}
+
+//Current slot usage
+func (d *WorkerDaemon) Stats() SlotStats {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := time.Now()
+	d.account(now)
+	stats := SlotStats{Slots: d.Slots, Busy: d.busy, Jobs: make(map[string]int)}
+	for job, n := range d.running {
+		stats.Jobs[job] = n
+	}
+	elapsed := now.Sub(d.reported)
+	if elapsed > 0 && d.Slots > 0 {
+		stats.Utilisation = float64(d.busytime) / float64(time.Duration(d.Slots)*elapsed)
+	}
+	return stats
+}
+
+//Log slot usage and start a new utilisation period
+func (d *WorkerDaemon) report() {
+	stats := d.Stats()
+	log.Printf("Slots busy %d/%d, utilisation %.1f%% over the last %s, jobs %v", stats.Busy, stats.Slots, stats.Utilisation*100, d.Report, stats.Jobs)
+	d.mu.Lock()
+	d.busytime = 0
+	d.reported = d.last
+	d.mu.Unlock()
+}
+
+//Register with the coordinator, including current slot usage
+func (d *WorkerDaemon) register() error {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	stats := d.Stats()
+	co, err := NewEnvironment().GetCoordinator()
+	if err != nil {
+		return err
+	}
+	defer co.Close()
+	return co.RegisterWorker(&WorkerInfo{
+		ID:        d.ID,
+		Hostname:  hostname,
+		Version:   Version,
+		GOOS:      runtime.GOOS,
+		GOARCH:    runtime.GOARCH,
+		Slots:     stats.Slots,
+		Busy:      stats.Busy,
+		Jobs:      stats.Jobs,
+		StartedAt: d.started,
+		Heartbeat: time.Now(),
+	}, DefaultWorkerTTL)
+}
+
+//Keep the registration alive, forever
+func (d *WorkerDaemon) heartbeat() {
+	for {
+		err := d.register()
+		if err != nil {
+			log.Println("Worker heartbeat failed:", err)
+		}
+		time.Sleep(workerheartbeat)
+	}
+}
+
+//Run task in a free slot
+func (d *WorkerDaemon) start(task *Task) {
+	task.worker = d.ID
+	d.mu.Lock()
+	d.account(time.Now())
+	d.busy++
+	d.running[task.JobName]++
+	d.mu.Unlock()
+	go func() {
+		err := task.Run()
+		if err != nil {
+			log.Println(task.JobName, err)
+		}
+		d.mu.Lock()
+		d.account(time.Now())
+		d.busy--
+		d.running[task.JobName]--
+		if d.running[task.JobName] == 0 {
+			delete(d.running, task.JobName)
+		}
+		d.mu.Unlock()
+		signal(d.freed)
+	}()
+}
+
+//Fill free slots with incomplete jobs, one slot per job in turn
+func (d *WorkerDaemon) schedule() {
+	tasks, err := GetIncompleteJobs()
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	if len(tasks) == 0 {
+		log.Println("Nothing to do... boring..")
+		return
+	}
+	d.mu.Lock()
+	free := d.Slots - d.busy
+	wanted := make(map[string]int)
+	for _, task := range tasks {
+		wanted[task.JobName] = task.Waiting - d.running[task.JobName]
+	}
+	d.mu.Unlock()
+	for free > 0 {
+		started := false
+		for _, task := range tasks {
+			if free > 0 && wanted[task.JobName] > 0 {
+				d.start(task)
+				wanted[task.JobName]--
+				free--
+				started = true
+			}
+		}
+		if !started {
+			break
+		}
+	}
+}
+
+//Look for work every Interval and run it, forever
+func (d *WorkerDaemon) Run() {
+	if d.Slots < 1 {
+		d.Slots = runtime.NumCPU()
+	}
+	if d.Report <= 0 {
+		d.Report = time.Minute
+	}
+	if d.Interval <= 0 {
+		d.Interval = DefaultInterval
+	}
+	if d.Fallback <= 0 {
+		d.Fallback = DefaultFallbackPoll
+	}
+	d.freed = make(chan struct{}, 1)
+	d.ID = newownerid()
+	d.started = time.Now()
+	d.mu.Lock()
+	d.running = make(map[string]int)
+	d.last = time.Now()
+	d.reported = d.last
+	d.mu.Unlock()
+	log.Println("Worker", d.ID, "running", d.Slots, "slots")
+	go d.heartbeat()
+	reports := time.NewTicker(d.Report)
+	defer reports.Stop()
+	var co Coordinator
+	var changes <-chan struct{}
+	var rewatch time.Time //When to try watching again after the watch failed
+	for {
+		if changes == nil && !time.Now().Before(rewatch) {
+			co, changes = d.watch()
+			if changes == nil {
+				rewatch = time.Now().Add(d.Interval)
+			}
+		}
+		wait := d.Interval
+		if changes != nil {
+			wait = d.Fallback
+		}
+		scheduled := time.Now()
+		d.schedule()
+		timer := time.NewTimer(wait)
+		select {
+		case <-reports.C:
+			d.report()
+		case <-timer.C:
+		case <-d.freed:
+		case _, ok := <-changes:
+			if !ok {
+				log.Println("Lost the coordinator watch, polling every", d.Interval)
+				co.Close()
+				changes = nil
+				rewatch = time.Now().Add(d.Interval)
+			}
+		}
+		timer.Stop()
+		if elapsed := time.Since(scheduled); elapsed < rescheduledelay {
+			time.Sleep(rescheduledelay - elapsed)
+		}
+	}
+}
+
+//Start watching the coordinator for changes, nil if that fails. The watch runs until the
+//coordinator is closed or the channel is closed on errors
+func (d *WorkerDaemon) watch() (Coordinator, <-chan struct{}) {
+	co, err := NewEnvironment().GetCoordinator()
+	if err != nil {
+		log.Println(err)
+		return nil, nil
+	}
+	changes, err := co.Watch(make(chan struct{}))
+	if err != nil {
+		log.Println("Can't watch the coordinator, polling every", d.Interval, err)
+		co.Close()
+		return nil, nil
+	}
+	return co, changes
+}
+
+//Worker daemon with one slot per CPU, checking for work every interval
+func RunWorker(interval time.Duration) {
+	(&WorkerDaemon{Interval: interval}).Run()
+}
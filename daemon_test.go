@@ -0,0 +1,81 @@
+package gomr
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestWaitingTasks(t *testing.T) {
+	c := NewMemoryCoordinator()
+	err := c.CreateJob(&JobInfo{Name: "job", NumMaps: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	attempt := &TaskAttempt{Owner: "a"}
+	steps := []struct {
+		name    string
+		op      func() error
+		waiting int
+	}{
+		{"new job", func() error {
+			return nil
+		}, 3},
+		{"map claimed", func() error {
+			_, err := c.ClaimTask("job", StageMap, 0, "input", "a", time.Minute)
+			return err
+		}, 2},
+		{"map backing off", func() error {
+			return c.ReleaseTask("job", StageMap, 0, "a", attempt, time.Now().Add(time.Minute))
+		}, 2},
+		{"maps done", func() error {
+			for _, id := range []int{1, 2} {
+				c.ClaimTask("job", StageMap, id, "input", "a", time.Minute)
+				err := c.CompleteTask("job", StageMap, id, "a", map[int]string{})
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		}, 0},
+		{"last map done", func() error {
+			c.jobs["job"].tasks[StageMap][0].RetryAfter = time.Time{}
+			c.ClaimTask("job", StageMap, 0, "input", "a", time.Minute)
+			return c.CompleteTask("job", StageMap, 0, "a", map[int]string{})
+		}, 1},
+		{"reduces set", func() error {
+			return c.SetNumReduces("job", 2)
+		}, 2},
+	}
+	for _, step := range steps {
+		err := step.op()
+		if err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		info, err := c.GetJob("job")
+		if err != nil {
+			t.Fatal(err)
+		}
+		waiting, err := waitingtasks(c, info)
+		if err != nil || waiting != step.waiting {
+			t.Errorf("%s: %d waiting %v, want %d", step.name, waiting, err, step.waiting)
+		}
+	}
+}
+
+func TestSlotStats(t *testing.T) {
+	start := time.Now().Add(-time.Second)
+	d := &WorkerDaemon{Slots: 4, running: map[string]int{"a": 2, "b": 1}, busy: 3, last: start, reported: start}
+	stats := d.Stats()
+	if stats.Slots != 4 || stats.Busy != 3 || len(stats.Jobs) != 2 || stats.Jobs["a"] != 2 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+	//3 of 4 slots were busy the whole time
+	if math.Abs(stats.Utilisation-0.75) > 0.05 {
+		t.Errorf("Utilisation %v, want 0.75", stats.Utilisation)
+	}
+	stats.Jobs["a"] = 0
+	if d.running["a"] != 2 {
+		t.Error("Stats shares the running jobs map")
+	}
+}
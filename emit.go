@@ -0,0 +1,339 @@
+package gomr
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+//Called by Map and Reduce functions to output a key/value pair
+type EmitFunc func(key, value string)
+
+//Runs once for each input, emitting intermediate key/value pairs
+type MapFunc func(input string, emit EmitFunc, job *Job, logger Logger) error
+
+//Runs once for each intermediate key with all values emitted for it, emitting final key/value pairs
+type ReduceFunc func(key string, values *Values, emit EmitFunc, job *Job, logger Logger) error
+
+//Higher level alternative to Worker. gomr takes care of partitioning, uploading and
+//downloading intermediate data, sorting and grouping values by key.
+//
+//Intermediate outputs are gzipped files of length-prefixed records, keys are assigned to
+//one of Job.Partitions partitions by the Partitioner, their FNV-1a hash by default.
+//Results have one entry per emitted pair in Job.OutputFormat, sorted by key within each partition.
+type EmitWorker struct {
+	Map          MapFunc
+	MapRecord    RecordMapFunc //Alternative to Map - Called once per record of each input, read with Job.OpenRecords
+	RecordFormat string        //Format of the records MapRecord gets, FormatLines by default
+	Reduce       ReduceFunc
+	Combine      ReduceFunc  //Optional - Pre-aggregates map output per key before it is spilled and uploaded. Must only emit the key it was called with
+	Partitioner  Partitioner //Optional - Overrides Job.Partitioner, can't be used with Job.SampleFraction
+}
+
+//Iterates over the values of a single key
+type Values struct {
+	next  func() (string, bool)
+	value string
+}
+
+//Advances to the next value, false once all values were consumed
+func (v *Values) Next() bool {
+	var ok bool
+	v.value, ok = v.next()
+	return ok
+}
+
+//The current value
+func (v *Values) Value() string {
+	return v.value
+}
+
+//Low level Worker running ew
+func (ew *EmitWorker) Worker() *Worker {
+	return &Worker{
+		Map:    ew.mapper,
+		Reduce: ew.reducer,
+		Sample: ew.sampler,
+	}
+}
+
+//Map, or one feeding the records of each input to MapRecord
+func (ew *EmitWorker) mapfunc() MapFunc {
+	if ew.MapRecord == nil {
+		return ew.Map
+	}
+	return func(input string, emit EmitFunc, job *Job, logger Logger) error {
+		records, err := job.OpenRecords(input, ew.RecordFormat)
+		if err != nil {
+			return err
+		}
+		defer records.Close()
+		for records.Next() {
+			err = ew.MapRecord(records.Record(), emit, job, logger)
+			if err != nil {
+				return err
+			}
+		}
+		return records.Err()
+	}
+}
+
+//Fetch a task to do and run it
+func (ew *EmitWorker) Execute(jobname string) {
+	ew.Worker().Execute(jobname)
+}
+
+//A key/value pair as stored in intermediate outputs
+type record struct {
+	key   string
+	value string
+}
+
+//Sort records by key, keeping the order of values within a key
+type recordsbykey []record
+
+func (a recordsbykey) Len() int           { return len(a) }
+func (a recordsbykey) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a recordsbykey) Less(i, j int) bool { return a[i].key < a[j].key }
+
+//Writes key and value each prefixed with their length as uvarint
+func writerecord(w *bufio.Writer, key, value string) error {
+	buf := make([]byte, binary.MaxVarintLen64)
+	for _, s := range []string{key, value} {
+		n := binary.PutUvarint(buf, uint64(len(s)))
+		_, err := w.Write(buf[:n])
+		if err != nil {
+			return err
+		}
+		_, err = w.WriteString(s)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//Reads a record written by writerecord, io.EOF if there are no more
+func readrecord(r *bufio.Reader) (record, error) {
+	rec := record{}
+	for i, s := range []*string{&rec.key, &rec.value} {
+		n, err := binary.ReadUvarint(r)
+		if err != nil {
+			if err == io.EOF && i > 0 {
+				err = io.ErrUnexpectedEOF
+			}
+			return rec, err
+		}
+		buf := make([]byte, n)
+		_, err = io.ReadFull(r, buf)
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return rec, err
+		}
+		*s = string(buf)
+	}
+	return rec, nil
+}
+
+//Intermediate output file of a single partition
+type partitionfile struct {
+	f *os.File
+	w *bufio.Writer
+}
+
+func newpartitionfile() (*partitionfile, error) {
+	f, err := ioutil.TempFile("", "")
+	if err != nil {
+		return nil, err
+	}
+	return &partitionfile{f, bufio.NewWriter(f)}, nil
+}
+
+//Wraps Combine so it can run on records of a single key, outside of Reduce
+func (ew *EmitWorker) combiner(job *Job, logger Logger) func(key string, values *Values, emit EmitFunc) error {
+	return func(key string, values *Values, emit EmitFunc) error {
+		var keyerr error
+		err := ew.Combine(key, values, func(k, v string) {
+			if k != key {
+				keyerr = errors.New("Combine emitted key '" + k + "' while combining '" + key + "'")
+				return
+			}
+			emit(k, v)
+		}, job, logger)
+		if err != nil {
+			return err
+		}
+		return keyerr
+	}
+}
+
+//Partitioner set on ew or the one the job asked for
+func (ew *EmitWorker) partitioner(job *Job) (Partitioner, error) {
+	if ew.Partitioner == nil {
+		return job.GetPartitioner()
+	}
+	if job.SampleFraction > 0 {
+		return nil, errSamplePartitioner
+	}
+	return ew.Partitioner, nil
+}
+
+func (ew *EmitWorker) mapper(input string, job *Job, logger Logger) (map[int]string, error) {
+	outputs := make(map[int]string)
+	partitioner, err := ew.partitioner(job)
+	if err != nil {
+		return outputs, err
+	}
+	files := make(map[int]*partitionfile)
+	//With a combiner records of all partitions are collected and combined first, sharing Job.SortMemory
+	var sorter *ExternalSorter
+	defer func() {
+		//Only left behind on errors, uploaded files are removed already
+		for _, pf := range files {
+			pf.f.Close()
+			os.Remove(pf.f.Name())
+		}
+		if sorter != nil {
+			sorter.Close()
+		}
+	}()
+	var combine func(key string, values *Values, emit EmitFunc) error
+	if ew.Combine != nil {
+		combine = ew.combiner(job, logger)
+		sorter = NewExternalSorter(job.SortMemory)
+		sorter.combine = combine
+	}
+	var emiterr error
+	//Write a record to the intermediate output of its partition
+	write := func(key, value string) {
+		p := partitioner.Partition(key, job.Partitions)
+		if p < 0 || p >= job.Partitions {
+			emiterr = fmt.Errorf("Partitioner returned partition %d for key '%s', the job has %d", p, key, job.Partitions)
+			return
+		}
+		pf, ok := files[p]
+		if !ok {
+			pf, emiterr = newpartitionfile()
+			if emiterr != nil {
+				return
+			}
+			files[p] = pf
+		}
+		emiterr = writerecord(pf.w, key, value)
+	}
+	emit := func(key, value string) {
+		if emiterr != nil {
+			return
+		}
+		if sorter != nil {
+			emiterr = sorter.Add(key, value)
+			return
+		}
+		write(key, value)
+	}
+	err = ew.mapfunc()(input, emit, job, logger)
+	if err != nil {
+		return outputs, err
+	}
+	if emiterr != nil {
+		return outputs, emiterr
+	}
+	//Combine once more across spilled runs
+	if sorter != nil {
+		groups, err := sorter.Sort()
+		if err != nil {
+			return outputs, err
+		}
+		for groups.Next() {
+			err = combine(groups.Key(), groups.Values(), func(key, value string) {
+				if emiterr == nil {
+					write(key, value)
+				}
+			})
+			if err != nil {
+				return outputs, err
+			}
+			if emiterr != nil {
+				return outputs, emiterr
+			}
+		}
+		if groups.Err() != nil {
+			return outputs, groups.Err()
+		}
+	}
+	//Upload each partition that got something
+	for p, pf := range files {
+		err = pf.w.Flush()
+		if err != nil {
+			return outputs, err
+		}
+		err = pf.f.Close()
+		if err != nil {
+			return outputs, err
+		}
+		outputs[p], err = job.UploadMapS3(pf.f.Name(), p)
+		if err != nil {
+			return outputs, err
+		}
+		delete(files, p)
+	}
+	return outputs, nil
+}
+
+func (ew *EmitWorker) reducer(inputs []string, partition int, job *Job, logger Logger) (string, error) {
+	groups, err := job.SortInputs(inputs)
+	if err != nil {
+		return "", err
+	}
+	defer groups.Close()
+	logger.Info("Reducing partition", partition)
+
+	output, err := ioutil.TempFile("", "")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(output.Name())
+	w, err := NewOutputWriter(job.OutputFormat, output)
+	if err != nil {
+		output.Close()
+		return "", err
+	}
+	var emiterr error
+	emit := func(key, value string) {
+		if emiterr == nil {
+			emiterr = w.Write(key, value)
+		}
+	}
+	//Hand each key to Reduce
+	for groups.Next() {
+		err = ew.Reduce(groups.Key(), groups.Values(), emit, job, logger)
+		if err != nil {
+			output.Close()
+			return "", err
+		}
+		if emiterr != nil {
+			output.Close()
+			return "", emiterr
+		}
+	}
+	if groups.Err() != nil {
+		output.Close()
+		return "", groups.Err()
+	}
+	err = w.Flush()
+	if err != nil {
+		output.Close()
+		return "", err
+	}
+	err = output.Close()
+	if err != nil {
+		return "", err
+	}
+	return job.UploadResultS3(output.Name())
+}
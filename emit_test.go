@@ -0,0 +1,58 @@
+package gomr
+
+import (
+	"strings"
+	"testing"
+)
+
+//Puts every key in the same partition
+type fixedpartitioner int
+
+func (p fixedpartitioner) Partition(key string, n int) int {
+	return int(p)
+}
+
+func TestMapperPartitionRange(t *testing.T) {
+	tests := []struct {
+		partition int
+		combine   bool
+	}{
+		{-1, false},
+		{2, false},
+		{2, true},
+	}
+	for _, test := range tests {
+		ew := &EmitWorker{
+			Map: func(input string, emit EmitFunc, job *Job, logger Logger) error {
+				emit("key", "1")
+				return nil
+			},
+			Partitioner: fixedpartitioner(test.partition),
+		}
+		if test.combine {
+			ew.Combine = func(key string, values *Values, emit EmitFunc, job *Job, logger Logger) error {
+				emit(key, "1")
+				return nil
+			}
+		}
+		_, err := ew.mapper("input", &Job{Partitions: 2}, NewConsoleLog(nil))
+		if err == nil || !strings.Contains(err.Error(), "partition") {
+			t.Errorf("Partition %d, combine %v: got %v", test.partition, test.combine, err)
+		}
+	}
+}
+
+func TestMapperPartitionerWithSampling(t *testing.T) {
+	ew := &EmitWorker{Map: func(input string, emit EmitFunc, job *Job, logger Logger) error {
+		return nil
+	}, Partitioner: fixedpartitioner(0)}
+	job := &Job{Partitions: 2, SampleFraction: 0.5}
+	_, err := ew.mapper("input", job, NewConsoleLog(nil))
+	if err != errSamplePartitioner {
+		t.Errorf("Mapper got %v", err)
+	}
+	_, err = ew.sampler([]string{"input"}, job, NewConsoleLog(nil))
+	if err != errSamplePartitioner {
+		t.Errorf("Sampler got %v", err)
+	}
+}
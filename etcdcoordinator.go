@@ -0,0 +1,619 @@
+package gomr
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/coreos/go-etcd/etcd"
+	"log"
+	"path"
+	"sort"
+	"strconv"
+	"time"
+)
+
+//etcd v2 error codes we care about
+const (
+	etcdErrKeyNotFound = 100
+	etcdErrTestFailed  = 101
+	etcdErrNodeExist   = 105
+)
+
+//Lease TTL while a completing task writes its outputs
+const etcdCompleteTTL = 30 * time.Second
+
+//Coordinator on top of the etcd v2 API.
+//
+//Key schema, everything lives under /gomr/<jobname>/
+//
+//	status, bin, s3bucket, s3prefix, createdat, nummaps, numreduces - job metadata
+//	failreason, failedtask - only present once the job failed
+//	map/<i>/ - map task i, contains status, lease, owner, input, outputs/<partition>, attempts/ and retryafter
+//	reduce/<i>/ - reduce task i, contains status, lease, owner, attempts/ and retryafter
+//	sample/0/ - sample task if the job samples its inputs, like a map task its output points at the split points
+//	results/<i> - output of reduce task i
+//
+//Claiming a task is done by creating its lease key, which fails if it already exists.
+//The lease key has a TTL so it vanishes if the owner stops renewing it.
+//
+//Worker daemons register as /gomrworkers/<id>, a JSON encoded WorkerInfo with a TTL. They live
+//outside of /gomr/ so they are never taken for jobs.
+type EtcdCoordinator struct {
+	client *etcd.Client
+}
+
+func NewEtcdCoordinator(machines []string) *EtcdCoordinator {
+	return &EtcdCoordinator{etcd.NewClient(machines)}
+}
+
+func iserrorcode(err error, code int) bool {
+	etcderr, ok := err.(*etcd.EtcdError)
+	return ok && etcderr.ErrorCode == code
+}
+
+func jobprefix(jobname string) string {
+	return "/gomr/" + jobname + "/"
+}
+
+func taskprefix(jobname, stage string, id int) string {
+	return jobprefix(jobname) + stage + "/" + strconv.Itoa(id) + "/"
+}
+
+func (c *EtcdCoordinator) CreateJob(info *JobInfo) error {
+	eprefix := jobprefix(info.Name)
+	//Create directory
+	_, err := c.client.CreateDir(eprefix, 0)
+	if err != nil {
+		return err
+	}
+	//Add job metadata
+	_, err = c.client.Create(eprefix+"status", strconv.Itoa(info.Status), 0)
+	if err != nil {
+		return err
+	}
+
+	//Add job binary info
+	_, err = c.client.Create(eprefix+"bin", info.Binary, 0)
+	if err != nil {
+		return err
+	}
+
+	//S3 bucket we are using
+	_, err = c.client.Create(eprefix+"s3bucket", info.S3Bucket, 0)
+	if err != nil {
+		return err
+	}
+
+	//S3 prefix
+	_, err = c.client.Create(eprefix+"s3prefix", info.S3Prefix, 0)
+	if err != nil {
+		return err
+	}
+
+	//Store CreatedAt
+	_, err = c.client.Create(eprefix+"createdat", info.CreatedAt.Format(time.RFC3339), 0)
+	if err != nil {
+		return err
+	}
+
+	//Store NumMaps
+	_, err = c.client.Create(eprefix+"nummaps", strconv.Itoa(info.NumMaps), 0)
+	if err != nil {
+		return err
+	}
+
+	//Store NumReduces - this will usually be 0 for now
+	_, err = c.client.Create(eprefix+"numreduces", strconv.Itoa(info.NumReduces), 0)
+	if err != nil {
+		return err
+	}
+
+	//Create directories for maps, reduces and results
+	for _, dir := range []string{StageMap, StageReduce, "results"} {
+		_, err = c.client.CreateDir(eprefix+dir+"/", 0)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *EtcdCoordinator) GetJob(jobname string) (*JobInfo, error) {
+	resp, err := c.client.Get(jobprefix(jobname), false, false)
+	if err != nil {
+		return nil, err
+	}
+	info := &JobInfo{Name: jobname}
+	found := 0
+	for _, node := range resp.Node.Nodes {
+		switch path.Base(node.Key) {
+		case "status":
+			info.Status, err = strconv.Atoi(node.Value)
+		case "bin":
+			info.Binary = node.Value
+		case "s3bucket":
+			info.S3Bucket = node.Value
+		case "s3prefix":
+			info.S3Prefix = node.Value
+		case "createdat":
+			info.CreatedAt, err = time.Parse(time.RFC3339, node.Value)
+		case "nummaps":
+			info.NumMaps, err = strconv.Atoi(node.Value)
+		case "numreduces":
+			info.NumReduces, err = strconv.Atoi(node.Value)
+		case "failreason":
+			info.FailReason = node.Value
+			continue
+		case "failedtask":
+			info.FailedTask = node.Value
+			continue
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		found++
+	}
+	//Deploy might still be writing the keys
+	if found != 7 {
+		return nil, errors.New("Job '" + jobname + "' is not fully created")
+	}
+	return info, nil
+}
+
+func (c *EtcdCoordinator) ListJobs() ([]string, error) {
+	jobs := []string{}
+	resp, err := c.client.Get("/gomr/", false, false)
+	if err != nil {
+		if iserrorcode(err, etcdErrKeyNotFound) {
+			return jobs, nil
+		}
+		return jobs, err
+	}
+	for _, node := range resp.Node.Nodes {
+		if node.Dir {
+			jobs = append(jobs, path.Base(node.Key))
+		}
+	}
+	return jobs, nil
+}
+
+func (c *EtcdCoordinator) DeleteJob(jobname string) error {
+	_, err := c.client.Delete(jobprefix(jobname), true)
+	if iserrorcode(err, etcdErrKeyNotFound) {
+		return nil
+	}
+	return err
+}
+
+func (c *EtcdCoordinator) SetJobStatus(jobname string, status int) error {
+	key := jobprefix(jobname) + "status"
+	resp, err := c.client.Get(key, false, false)
+	if err != nil {
+		return err
+	}
+	switch resp.Node.Value {
+	case strconv.Itoa(StatusFail):
+		return ErrJobFailed
+	case strconv.Itoa(StatusCancelled):
+		return ErrJobCancelled
+	}
+	//Make sure the job didn't fail or get cancelled in the meantime
+	_, err = c.client.CompareAndSwap(key, strconv.Itoa(status), 0, "", resp.Node.ModifiedIndex)
+	if iserrorcode(err, etcdErrTestFailed) {
+		return c.SetJobStatus(jobname, status)
+	}
+	return err
+}
+
+func (c *EtcdCoordinator) CancelJob(jobname string) error {
+	key := jobprefix(jobname) + "status"
+	resp, err := c.client.Get(key, false, false)
+	if err != nil {
+		return err
+	}
+	switch resp.Node.Value {
+	case strconv.Itoa(StatusDone), strconv.Itoa(StatusFail):
+		return errors.New("Job '" + jobname + "' already finished")
+	case strconv.Itoa(StatusCancelled):
+		return nil
+	}
+	_, err = c.client.CompareAndSwap(key, strconv.Itoa(StatusCancelled), 0, "", resp.Node.ModifiedIndex)
+	if iserrorcode(err, etcdErrTestFailed) {
+		return c.CancelJob(jobname)
+	}
+	return err
+}
+
+func (c *EtcdCoordinator) FailJob(jobname, reason, task string) error {
+	eprefix := jobprefix(jobname)
+	resp, err := c.client.Get(eprefix+"status", false, false)
+	if err != nil {
+		return err
+	}
+	switch resp.Node.Value {
+	case strconv.Itoa(StatusFail):
+		return ErrJobFailed
+	case strconv.Itoa(StatusCancelled):
+		return ErrJobCancelled
+	case strconv.Itoa(StatusDone):
+		return errors.New("Job '" + jobname + "' already finished")
+	}
+	//Status first, so a job cancelled in the meantime doesn't get a fail reason
+	_, err = c.client.CompareAndSwap(eprefix+"status", strconv.Itoa(StatusFail), 0, "", resp.Node.ModifiedIndex)
+	if iserrorcode(err, etcdErrTestFailed) {
+		return c.FailJob(jobname, reason, task)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = c.client.Set(eprefix+"failreason", reason, 0)
+	if err != nil {
+		return err
+	}
+	_, err = c.client.Set(eprefix+"failedtask", task, 0)
+	return err
+}
+
+func (c *EtcdCoordinator) SetNumReduces(jobname string, n int) error {
+	_, err := c.client.Update(jobprefix(jobname)+"numreduces", strconv.Itoa(n), 0)
+	return err
+}
+
+//etcd v2 TTLs are whole seconds
+func ttlseconds(ttl time.Duration) uint64 {
+	if ttl < time.Second {
+		return 1
+	}
+	return uint64(ttl / time.Second)
+}
+
+func (c *EtcdCoordinator) ClaimTask(jobname, stage string, id int, input, owner string, ttl time.Duration) (bool, error) {
+	tprefix := taskprefix(jobname, stage, id)
+	//Make sure the task directory exists, doesn't matter who created it
+	_, err := c.client.CreateDir(tprefix, 0)
+	if err != nil && !iserrorcode(err, etcdErrNodeExist) {
+		return false, err
+	}
+	resp, err := c.client.Get(tprefix, false, false)
+	if err != nil {
+		return false, err
+	}
+	var statusnode *etcd.Node
+	var retryindex uint64
+	for _, node := range resp.Node.Nodes {
+		switch path.Base(node.Key) {
+		case "status":
+			statusnode = node
+			if node.Value != strconv.Itoa(StatusInitialized) {
+				//Done or failed for good
+				return false, nil
+			}
+		case "retryafter":
+			retryindex = node.ModifiedIndex
+			retryafter, err := time.Parse(time.RFC3339Nano, node.Value)
+			if err != nil {
+				return false, err
+			}
+			if retryafter.After(time.Now()) {
+				return false, nil
+			}
+		}
+	}
+	//Whoever creates the lease owns the task, it disappears by itself if not renewed
+	_, err = c.client.Create(tprefix+"lease", owner, ttlseconds(ttl))
+	if err != nil {
+		if iserrorcode(err, etcdErrNodeExist) {
+			//Somebody else has it
+			return false, nil
+		}
+		return false, err
+	}
+	//The previous owner sets retryafter before giving up the lease, if it changed since we
+	//looked the task was released and may not be due yet
+	resp, err = c.client.Get(tprefix+"retryafter", false, false)
+	if err != nil && !iserrorcode(err, etcdErrKeyNotFound) {
+		c.client.CompareAndDelete(tprefix+"lease", owner, 0)
+		return false, err
+	}
+	if err == nil && resp.Node.ModifiedIndex != retryindex {
+		c.client.CompareAndDelete(tprefix+"lease", owner, 0)
+		return false, nil
+	}
+	//Make sure nobody completed the task since we looked at it
+	if statusnode == nil {
+		_, err = c.client.Create(tprefix+"status", strconv.Itoa(StatusInitialized), 0)
+	} else {
+		_, err = c.client.CompareAndSwap(tprefix+"status", strconv.Itoa(StatusInitialized), 0, "", statusnode.ModifiedIndex)
+	}
+	if err != nil {
+		c.client.CompareAndDelete(tprefix+"lease", owner, 0)
+		if iserrorcode(err, etcdErrNodeExist) || iserrorcode(err, etcdErrTestFailed) {
+			return false, nil
+		}
+		return false, err
+	}
+	_, err = c.client.Set(tprefix+"owner", owner, 0)
+	if err != nil {
+		return true, err
+	}
+	//Drop whatever a previous owner managed to write
+	_, err = c.client.Delete(tprefix+"outputs", true)
+	if err != nil && !iserrorcode(err, etcdErrKeyNotFound) {
+		return true, err
+	}
+	if stage == StageMap {
+		//Write input url
+		_, err = c.client.Set(tprefix+"input", input, 0)
+		if err != nil {
+			return true, err
+		}
+	}
+	return true, nil
+}
+
+//Refresh the lease TTL, failing if it expired or belongs to somebody else
+func (c *EtcdCoordinator) RenewTask(jobname, stage string, id int, owner string, ttl time.Duration) error {
+	_, err := c.client.CompareAndSwap(taskprefix(jobname, stage, id)+"lease", owner, ttlseconds(ttl), owner, 0)
+	if err != nil {
+		if iserrorcode(err, etcdErrKeyNotFound) || iserrorcode(err, etcdErrTestFailed) {
+			return ErrLostLease
+		}
+		return err
+	}
+	return nil
+}
+
+func (c *EtcdCoordinator) CompleteTask(jobname, stage string, id int, owner string, outputs map[int]string) error {
+	tprefix := taskprefix(jobname, stage, id)
+	//Check we still own the task
+	err := c.RenewTask(jobname, stage, id, owner, etcdCompleteTTL)
+	if err != nil {
+		return err
+	}
+	if stage != StageReduce {
+		//Store outputs in etcd
+		_, err := c.client.CreateDir(tprefix+"outputs/", 0)
+		if err != nil && !iserrorcode(err, etcdErrNodeExist) {
+			return err
+		}
+		for idx, output := range outputs {
+			_, err = c.client.Set(tprefix+"outputs/"+strconv.Itoa(idx), output, 0)
+			if err != nil {
+				return err
+			}
+		}
+	} else {
+		//Write result to etcd
+		for idx, output := range outputs {
+			_, err := c.client.Set(jobprefix(jobname)+"results/"+strconv.Itoa(idx), output, 0)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	//Mark as done
+	_, err = c.client.Update(tprefix+"status", strconv.Itoa(StatusDone), 0)
+	if err != nil {
+		return err
+	}
+	//Release the lease, the status change stops anyone from claiming it again
+	_, err = c.client.CompareAndDelete(tprefix+"lease", owner, 0)
+	if err != nil && !iserrorcode(err, etcdErrKeyNotFound) {
+		return err
+	}
+	return nil
+}
+
+//Record attempt and drop the lease of a failed task, setting the status if it is not 0
+func (c *EtcdCoordinator) endattempt(jobname, stage string, id int, owner string, attempt *TaskAttempt, retryafter time.Time, status int) error {
+	tprefix := taskprefix(jobname, stage, id)
+	//Check we still own the task
+	err := c.RenewTask(jobname, stage, id, owner, etcdCompleteTTL)
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(attempt)
+	if err != nil {
+		return err
+	}
+	//In-order keys keep the attempts sorted
+	_, err = c.client.AddChild(tprefix+"attempts", string(b), 0)
+	if err != nil {
+		return err
+	}
+	if status != 0 {
+		_, err = c.client.Update(tprefix+"status", strconv.Itoa(status), 0)
+	} else {
+		_, err = c.client.Set(tprefix+"retryafter", retryafter.Format(time.RFC3339Nano), 0)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = c.client.CompareAndDelete(tprefix+"lease", owner, 0)
+	if err != nil && !iserrorcode(err, etcdErrKeyNotFound) {
+		return err
+	}
+	return nil
+}
+
+func (c *EtcdCoordinator) ReleaseTask(jobname, stage string, id int, owner string, attempt *TaskAttempt, retryafter time.Time) error {
+	return c.endattempt(jobname, stage, id, owner, attempt, retryafter, 0)
+}
+
+func (c *EtcdCoordinator) FailTask(jobname, stage string, id int, owner string, attempt *TaskAttempt) error {
+	return c.endattempt(jobname, stage, id, owner, attempt, time.Time{}, StatusFail)
+}
+
+//Parse a task directory fetched recursively
+func parseetcdtask(node *etcd.Node) (*TaskInfo, error) {
+	id, err := strconv.Atoi(path.Base(node.Key))
+	if err != nil {
+		return nil, err
+	}
+	task := &TaskInfo{ID: id, Outputs: make(map[int]string)}
+	for _, subnode := range node.Nodes {
+		switch path.Base(subnode.Key) {
+		case "status":
+			task.Status, err = strconv.Atoi(subnode.Value)
+			if err != nil {
+				return nil, err
+			}
+		case "input":
+			task.Input = subnode.Value
+		case "owner":
+			task.Owner = subnode.Value
+		case "lease":
+			task.Leased = true
+		case "retryafter":
+			task.RetryAfter, err = time.Parse(time.RFC3339Nano, subnode.Value)
+			if err != nil {
+				return nil, err
+			}
+		case "attempts":
+			for _, attemptnode := range subnode.Nodes {
+				attempt := &TaskAttempt{}
+				err = json.Unmarshal([]byte(attemptnode.Value), attempt)
+				if err != nil {
+					return nil, err
+				}
+				task.Attempts = append(task.Attempts, attempt)
+			}
+			sort.Sort(attemptsbytime(task.Attempts))
+		case "outputs":
+			for _, output := range subnode.Nodes {
+				partitionid, err := strconv.Atoi(path.Base(output.Key))
+				if err != nil {
+					return nil, err
+				}
+				task.Outputs[partitionid] = output.Value
+			}
+		}
+	}
+	return task, nil
+}
+
+func (c *EtcdCoordinator) GetTask(jobname, stage string, id int) (*TaskInfo, error) {
+	resp, err := c.client.Get(taskprefix(jobname, stage, id), false, true)
+	if err != nil {
+		if iserrorcode(err, etcdErrKeyNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return parseetcdtask(resp.Node)
+}
+
+func (c *EtcdCoordinator) ListTasks(jobname, stage string) ([]*TaskInfo, error) {
+	tasks := []*TaskInfo{}
+	resp, err := c.client.Get(jobprefix(jobname)+stage, false, true)
+	if err != nil {
+		//Only jobs that sample their inputs have a sample stage
+		if iserrorcode(err, etcdErrKeyNotFound) {
+			return tasks, nil
+		}
+		return tasks, err
+	}
+	for _, node := range resp.Node.Nodes {
+		task, err := parseetcdtask(node)
+		if err != nil {
+			return tasks, err
+		}
+		tasks = append(tasks, task)
+	}
+	sort.Sort(tasksbyid(tasks))
+	return tasks, nil
+}
+
+func (c *EtcdCoordinator) Results(jobname string) (map[int]string, error) {
+	results := make(map[int]string)
+	resp, err := c.client.Get(jobprefix(jobname)+"results", false, false)
+	if err != nil {
+		return results, err
+	}
+	for _, node := range resp.Node.Nodes {
+		partitionid, err := strconv.Atoi(path.Base(node.Key))
+		if err != nil {
+			return results, err
+		}
+		results[partitionid] = node.Value
+	}
+	return results, nil
+}
+
+func workerkey(id string) string {
+	return "/gomrworkers/" + id
+}
+
+func (c *EtcdCoordinator) RegisterWorker(info *WorkerInfo, ttl time.Duration) error {
+	b, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	_, err = c.client.Set(workerkey(info.ID), string(b), ttlseconds(ttl))
+	return err
+}
+
+func (c *EtcdCoordinator) ListWorkers() ([]*WorkerInfo, error) {
+	workers := []*WorkerInfo{}
+	resp, err := c.client.Get("/gomrworkers/", true, false)
+	if iserrorcode(err, etcdErrKeyNotFound) {
+		return workers, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, node := range resp.Node.Nodes {
+		info := &WorkerInfo{}
+		err = json.Unmarshal([]byte(node.Value), info)
+		if err != nil {
+			return nil, err
+		}
+		workers = append(workers, info)
+	}
+	sort.Sort(workersbyid(workers))
+	return workers, nil
+}
+
+func (c *EtcdCoordinator) Watch(stop <-chan struct{}) (<-chan struct{}, error) {
+	notify := make(chan struct{}, 1)
+	receiver := make(chan *etcd.Response)
+	stopwatch := make(chan bool)
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-stop:
+			close(stopwatch)
+		case <-done:
+		}
+	}()
+	go func() {
+		//Watch closes receiver when it returns
+		_, err := c.client.Watch("/gomr/", 0, true, receiver, stopwatch)
+		if err != nil && err != etcd.ErrWatchStoppedByUser {
+			log.Println("etcd watch ended:", err)
+		}
+	}()
+	go func() {
+		defer close(notify)
+		defer close(done)
+		for resp := range receiver {
+			if resp.Node == nil {
+				continue
+			}
+			deleted := resp.Action == "delete" || resp.Action == "expire" || resp.Action == "compareAndDelete"
+			var prev *string
+			if resp.PrevNode != nil {
+				prev = &resp.PrevNode.Value
+			}
+			if wakesworkers(resp.Node.Key, resp.Node.Value, prev, deleted) {
+				signal(notify)
+			}
+		}
+	}()
+	return notify, nil
+}
+
+func (c *EtcdCoordinator) Close() {
+	c.client.Close()
+}
@@ -0,0 +1,630 @@
+package gomr
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//Timeout for individual etcd requests
+const etcdv3Timeout = 10 * time.Second
+
+//etcd limits the number of operations in a single transaction, stay well below the default of 128
+const txnBatchSize = 100
+
+//Coordinator on top of the etcd v3 API.
+//
+//Uses the same key names as EtcdCoordinator, but as there are no directories in v3 every
+//key is a plain key under /gomr/<jobname>/. Tasks are claimed by a transaction which creates
+//<stage>/<i>/lock only if nobody holds it and the task status did not change since we looked at it.
+//Each lock is attached to its own lease which the owner keeps alive through RenewTask, so the
+//lock vanishes and the task becomes claimable again once the owner stops renewing it.
+type EtcdV3Coordinator struct {
+	client *clientv3.Client
+}
+
+func NewEtcdV3Coordinator(endpoints []string) (*EtcdV3Coordinator, error) {
+	client, err := clientv3.New(clientv3.Config{
+		Endpoints:   endpoints,
+		DialTimeout: etcdv3Timeout,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &EtcdV3Coordinator{client}, nil
+}
+
+func (c *EtcdV3Coordinator) context() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), etcdv3Timeout)
+}
+
+func (c *EtcdV3Coordinator) CreateJob(info *JobInfo) error {
+	eprefix := jobprefix(info.Name)
+	ctx, cancel := c.context()
+	defer cancel()
+	//Create everything at once, only if the job does not exist yet
+	resp, err := c.client.Txn(ctx).If(
+		clientv3.Compare(clientv3.CreateRevision(eprefix+"status"), "=", 0),
+	).Then(
+		clientv3.OpPut(eprefix+"status", strconv.Itoa(info.Status)),
+		clientv3.OpPut(eprefix+"bin", info.Binary),
+		clientv3.OpPut(eprefix+"s3bucket", info.S3Bucket),
+		clientv3.OpPut(eprefix+"s3prefix", info.S3Prefix),
+		clientv3.OpPut(eprefix+"createdat", info.CreatedAt.Format(time.RFC3339)),
+		clientv3.OpPut(eprefix+"nummaps", strconv.Itoa(info.NumMaps)),
+		clientv3.OpPut(eprefix+"numreduces", strconv.Itoa(info.NumReduces)),
+	).Commit()
+	if err != nil {
+		return err
+	}
+	if !resp.Succeeded {
+		return errors.New("Job '" + info.Name + "' already exists")
+	}
+	return nil
+}
+
+func (c *EtcdV3Coordinator) GetJob(jobname string) (*JobInfo, error) {
+	eprefix := jobprefix(jobname)
+	keys := []string{"status", "bin", "s3bucket", "s3prefix", "createdat", "nummaps", "numreduces", "failreason", "failedtask"}
+	ops := []clientv3.Op{}
+	for _, key := range keys {
+		ops = append(ops, clientv3.OpGet(eprefix+key))
+	}
+	ctx, cancel := c.context()
+	defer cancel()
+	//Single transaction so we get a consistent snapshot
+	resp, err := c.client.Txn(ctx).Then(ops...).Commit()
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string]string)
+	for i, r := range resp.Responses {
+		kvs := r.GetResponseRange().Kvs
+		if len(kvs) > 0 {
+			values[keys[i]] = string(kvs[0].Value)
+		}
+	}
+	if _, ok := values["status"]; !ok {
+		return nil, errors.New("Job '" + jobname + "' not found")
+	}
+	info := &JobInfo{
+		Name:       jobname,
+		Binary:     values["bin"],
+		S3Bucket:   values["s3bucket"],
+		S3Prefix:   values["s3prefix"],
+		FailReason: values["failreason"],
+		FailedTask: values["failedtask"],
+	}
+	info.Status, err = strconv.Atoi(values["status"])
+	if err != nil {
+		return nil, err
+	}
+	info.CreatedAt, err = time.Parse(time.RFC3339, values["createdat"])
+	if err != nil {
+		return nil, err
+	}
+	info.NumMaps, err = strconv.Atoi(values["nummaps"])
+	if err != nil {
+		return nil, err
+	}
+	info.NumReduces, err = strconv.Atoi(values["numreduces"])
+	if err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+func (c *EtcdV3Coordinator) ListJobs() ([]string, error) {
+	jobs := []string{}
+	ctx, cancel := c.context()
+	defer cancel()
+	resp, err := c.client.Get(ctx, "/gomr/", clientv3.WithPrefix(), clientv3.WithKeysOnly())
+	if err != nil {
+		return jobs, err
+	}
+	//Every job has exactly one /gomr/<jobname>/status key
+	for _, kv := range resp.Kvs {
+		splitted := strings.Split(string(kv.Key), "/")
+		if len(splitted) == 4 && splitted[3] == "status" {
+			jobs = append(jobs, splitted[2])
+		}
+	}
+	return jobs, nil
+}
+
+func (c *EtcdV3Coordinator) put(key, value string) error {
+	ctx, cancel := c.context()
+	defer cancel()
+	_, err := c.client.Put(ctx, key, value)
+	return err
+}
+
+func (c *EtcdV3Coordinator) DeleteJob(jobname string) error {
+	ctx, cancel := c.context()
+	defer cancel()
+	_, err := c.client.Delete(ctx, jobprefix(jobname), clientv3.WithPrefix())
+	return err
+}
+
+func (c *EtcdV3Coordinator) SetJobStatus(jobname string, status int) error {
+	key := jobprefix(jobname) + "status"
+	ctx, cancel := c.context()
+	defer cancel()
+	txn, err := c.client.Txn(ctx).If(
+		clientv3.Compare(clientv3.Value(key), "!=", strconv.Itoa(StatusFail)),
+		clientv3.Compare(clientv3.Value(key), "!=", strconv.Itoa(StatusCancelled)),
+	).Then(clientv3.OpPut(key, strconv.Itoa(status))).Else(clientv3.OpGet(key)).Commit()
+	if err != nil {
+		return err
+	}
+	if !txn.Succeeded {
+		kvs := txn.Responses[0].GetResponseRange().Kvs
+		if len(kvs) > 0 && string(kvs[0].Value) == strconv.Itoa(StatusCancelled) {
+			return ErrJobCancelled
+		}
+		return ErrJobFailed
+	}
+	return nil
+}
+
+func (c *EtcdV3Coordinator) CancelJob(jobname string) error {
+	key := jobprefix(jobname) + "status"
+	ctx, cancel := c.context()
+	defer cancel()
+	txn, err := c.client.Txn(ctx).If(
+		clientv3.Compare(clientv3.CreateRevision(key), ">", 0),
+		clientv3.Compare(clientv3.Value(key), "!=", strconv.Itoa(StatusDone)),
+		clientv3.Compare(clientv3.Value(key), "!=", strconv.Itoa(StatusFail)),
+	).Then(clientv3.OpPut(key, strconv.Itoa(StatusCancelled))).Commit()
+	if err != nil {
+		return err
+	}
+	if !txn.Succeeded {
+		return errors.New("Job '" + jobname + "' not found or already finished")
+	}
+	return nil
+}
+
+func (c *EtcdV3Coordinator) FailJob(jobname, reason, task string) error {
+	eprefix := jobprefix(jobname)
+	key := eprefix + "status"
+	ctx, cancel := c.context()
+	defer cancel()
+	txn, err := c.client.Txn(ctx).If(
+		clientv3.Compare(clientv3.Value(key), "!=", strconv.Itoa(StatusFail)),
+		clientv3.Compare(clientv3.Value(key), "!=", strconv.Itoa(StatusCancelled)),
+		clientv3.Compare(clientv3.Value(key), "!=", strconv.Itoa(StatusDone)),
+	).Then(
+		clientv3.OpPut(eprefix+"failreason", reason),
+		clientv3.OpPut(eprefix+"failedtask", task),
+		clientv3.OpPut(key, strconv.Itoa(StatusFail)),
+	).Else(clientv3.OpGet(key)).Commit()
+	if err != nil {
+		return err
+	}
+	if !txn.Succeeded {
+		kvs := txn.Responses[0].GetResponseRange().Kvs
+		if len(kvs) > 0 {
+			switch string(kvs[0].Value) {
+			case strconv.Itoa(StatusCancelled):
+				return ErrJobCancelled
+			case strconv.Itoa(StatusDone):
+				return errors.New("Job '" + jobname + "' already finished")
+			}
+		}
+		return ErrJobFailed
+	}
+	return nil
+}
+
+func (c *EtcdV3Coordinator) SetNumReduces(jobname string, n int) error {
+	return c.put(jobprefix(jobname)+"numreduces", strconv.Itoa(n))
+}
+
+func (c *EtcdV3Coordinator) ClaimTask(jobname, stage string, id int, input, owner string, ttl time.Duration) (bool, error) {
+	tprefix := taskprefix(jobname, stage, id)
+	ctx, cancel := c.context()
+	defer cancel()
+	resp, err := c.client.Txn(ctx).Then(
+		clientv3.OpGet(tprefix+"status"),
+		clientv3.OpGet(tprefix+"retryafter"),
+	).Commit()
+	if err != nil {
+		return false, err
+	}
+	//ModRevision of a missing key compares equal to 0
+	var statusrev, retryrev int64
+	if status := resp.Responses[0].GetResponseRange().Kvs; len(status) > 0 {
+		if string(status[0].Value) != strconv.Itoa(StatusInitialized) {
+			//Done or failed for good
+			return false, nil
+		}
+		statusrev = status[0].ModRevision
+	}
+	if retry := resp.Responses[1].GetResponseRange().Kvs; len(retry) > 0 {
+		retryrev = retry[0].ModRevision
+		retryafter, err := time.Parse(time.RFC3339Nano, string(retry[0].Value))
+		if err != nil {
+			return false, err
+		}
+		if retryafter.After(time.Now()) {
+			return false, nil
+		}
+	}
+	lease, err := c.client.Grant(ctx, int64(ttlseconds(ttl)))
+	if err != nil {
+		return false, err
+	}
+	ops := []clientv3.Op{
+		clientv3.OpPut(tprefix+"lock", owner, clientv3.WithLease(lease.ID)),
+		clientv3.OpPut(tprefix+"owner", owner),
+		clientv3.OpPut(tprefix+"status", strconv.Itoa(StatusInitialized)),
+		//Drop whatever a previous owner managed to write
+		clientv3.OpDelete(tprefix+"outputs/", clientv3.WithPrefix()),
+	}
+	if stage == StageMap {
+		ops = append(ops, clientv3.OpPut(tprefix+"input", input))
+	}
+	txn, err := c.client.Txn(ctx).If(
+		clientv3.Compare(clientv3.CreateRevision(tprefix+"lock"), "=", 0),
+		clientv3.Compare(clientv3.ModRevision(tprefix+"status"), "=", statusrev),
+		//A release since we looked may have set a new backoff
+		clientv3.Compare(clientv3.ModRevision(tprefix+"retryafter"), "=", retryrev),
+	).Then(ops...).Commit()
+	if err != nil || !txn.Succeeded {
+		c.client.Revoke(ctx, lease.ID)
+		return false, err
+	}
+	return true, nil
+}
+
+//Keeps the lease attached to the lock alive. The lease keeps the TTL it was granted with
+func (c *EtcdV3Coordinator) RenewTask(jobname, stage string, id int, owner string, ttl time.Duration) error {
+	ctx, cancel := c.context()
+	defer cancel()
+	resp, err := c.client.Get(ctx, taskprefix(jobname, stage, id)+"lock")
+	if err != nil {
+		return err
+	}
+	if len(resp.Kvs) == 0 || string(resp.Kvs[0].Value) != owner {
+		return ErrLostLease
+	}
+	_, err = c.client.KeepAliveOnce(ctx, clientv3.LeaseID(resp.Kvs[0].Lease))
+	if err == rpctypes.ErrLeaseNotFound {
+		return ErrLostLease
+	}
+	return err
+}
+
+//Puts storing the outputs of a task, in batches small enough for a single transaction
+func outputbatches(jobname, stage string, id int, outputs map[int]string) [][]clientv3.Op {
+	batches := [][]clientv3.Op{}
+	ops := []clientv3.Op{}
+	for idx, output := range outputs {
+		if stage != StageReduce {
+			ops = append(ops, clientv3.OpPut(taskprefix(jobname, stage, id)+"outputs/"+strconv.Itoa(idx), output))
+		} else {
+			ops = append(ops, clientv3.OpPut(jobprefix(jobname)+"results/"+strconv.Itoa(idx), output))
+		}
+		if len(ops) == txnBatchSize {
+			batches = append(batches, ops)
+			ops = []clientv3.Op{}
+		}
+	}
+	if len(ops) > 0 {
+		batches = append(batches, ops)
+	}
+	return batches
+}
+
+//Ops marking a task done, fetching the lock first so we know which lease to revoke
+func completeops(tprefix string) []clientv3.Op {
+	return []clientv3.Op{
+		clientv3.OpGet(tprefix + "lock"),
+		clientv3.OpPut(tprefix+"status", strconv.Itoa(StatusDone)),
+		clientv3.OpDelete(tprefix + "lock"),
+	}
+}
+
+func (c *EtcdV3Coordinator) CompleteTask(jobname, stage string, id int, owner string, outputs map[int]string) error {
+	tprefix := taskprefix(jobname, stage, id)
+	ctx, cancel := c.context()
+	defer cancel()
+	//Only the lock holder may store outputs and complete the task. Jobs with many partitions
+	//have more outputs than a transaction may hold, they are stored batch by batch first
+	owned := clientv3.Compare(clientv3.Value(tprefix+"lock"), "=", owner)
+	for _, ops := range outputbatches(jobname, stage, id, outputs) {
+		txn, err := c.client.Txn(ctx).If(owned).Then(ops...).Commit()
+		if err != nil {
+			return err
+		}
+		if !txn.Succeeded {
+			return ErrLostLease
+		}
+	}
+	txn, err := c.client.Txn(ctx).If(owned).Then(completeops(tprefix)...).Commit()
+	if err != nil {
+		return err
+	}
+	if !txn.Succeeded {
+		return ErrLostLease
+	}
+	lock := txn.Responses[0].GetResponseRange().Kvs
+	if len(lock) > 0 {
+		c.client.Revoke(ctx, clientv3.LeaseID(lock[0].Lease))
+	}
+	return nil
+}
+
+//Record attempt and drop the lock of a failed task, the ops set the new task state
+func (c *EtcdV3Coordinator) endattempt(jobname, stage string, id int, owner string, attempt *TaskAttempt, ops ...clientv3.Op) error {
+	tprefix := taskprefix(jobname, stage, id)
+	b, err := json.Marshal(attempt)
+	if err != nil {
+		return err
+	}
+	ops = append([]clientv3.Op{
+		clientv3.OpGet(tprefix + "lock"),
+		//Zero padded so keys sort by time
+		clientv3.OpPut(fmt.Sprintf("%sattempts/%020d", tprefix, attempt.Started.UnixNano()), string(b)),
+		clientv3.OpDelete(tprefix + "lock"),
+	}, ops...)
+	ctx, cancel := c.context()
+	defer cancel()
+	txn, err := c.client.Txn(ctx).If(
+		clientv3.Compare(clientv3.Value(tprefix+"lock"), "=", owner),
+	).Then(ops...).Commit()
+	if err != nil {
+		return err
+	}
+	if !txn.Succeeded {
+		return ErrLostLease
+	}
+	lock := txn.Responses[0].GetResponseRange().Kvs
+	if len(lock) > 0 {
+		c.client.Revoke(ctx, clientv3.LeaseID(lock[0].Lease))
+	}
+	return nil
+}
+
+func (c *EtcdV3Coordinator) ReleaseTask(jobname, stage string, id int, owner string, attempt *TaskAttempt, retryafter time.Time) error {
+	return c.endattempt(jobname, stage, id, owner, attempt,
+		clientv3.OpPut(taskprefix(jobname, stage, id)+"retryafter", retryafter.Format(time.RFC3339Nano)))
+}
+
+func (c *EtcdV3Coordinator) FailTask(jobname, stage string, id int, owner string, attempt *TaskAttempt) error {
+	return c.endattempt(jobname, stage, id, owner, attempt,
+		clientv3.OpPut(taskprefix(jobname, stage, id)+"status", strconv.Itoa(StatusFail)))
+}
+
+//Parse task keys fetched with prefix /gomr/<jobname>/<stage>/
+func parseetcdv3tasks(prefix string, resp *clientv3.GetResponse) (map[int]*TaskInfo, error) {
+	tasks := make(map[int]*TaskInfo)
+	claimed := make(map[int]bool)
+	for _, kv := range resp.Kvs {
+		splitted := strings.Split(strings.TrimPrefix(string(kv.Key), prefix), "/")
+		id, err := strconv.Atoi(splitted[0])
+		if err != nil {
+			return nil, err
+		}
+		task, ok := tasks[id]
+		if !ok {
+			task = &TaskInfo{ID: id, Outputs: make(map[int]string)}
+			tasks[id] = task
+		}
+		switch {
+		case len(splitted) == 2 && splitted[1] == "status":
+			task.Status, err = strconv.Atoi(string(kv.Value))
+			if err != nil {
+				return nil, err
+			}
+			claimed[id] = true
+		case len(splitted) == 2 && splitted[1] == "input":
+			task.Input = string(kv.Value)
+		case len(splitted) == 2 && splitted[1] == "owner":
+			task.Owner = string(kv.Value)
+		case len(splitted) == 2 && splitted[1] == "lock":
+			task.Leased = true
+		case len(splitted) == 2 && splitted[1] == "retryafter":
+			task.RetryAfter, err = time.Parse(time.RFC3339Nano, string(kv.Value))
+			if err != nil {
+				return nil, err
+			}
+		case len(splitted) == 3 && splitted[1] == "attempts":
+			//Keys are sorted so attempts arrive oldest first
+			attempt := &TaskAttempt{}
+			err = json.Unmarshal(kv.Value, attempt)
+			if err != nil {
+				return nil, err
+			}
+			task.Attempts = append(task.Attempts, attempt)
+		case len(splitted) == 3 && splitted[1] == "outputs":
+			partitionid, err := strconv.Atoi(splitted[2])
+			if err != nil {
+				return nil, err
+			}
+			task.Outputs[partitionid] = string(kv.Value)
+		}
+	}
+	//A task only exists once its status is written
+	for id, _ := range tasks {
+		if !claimed[id] {
+			delete(tasks, id)
+		}
+	}
+	return tasks, nil
+}
+
+func (c *EtcdV3Coordinator) GetTask(jobname, stage string, id int) (*TaskInfo, error) {
+	prefix := jobprefix(jobname) + stage + "/"
+	ctx, cancel := c.context()
+	defer cancel()
+	resp, err := c.client.Get(ctx, taskprefix(jobname, stage, id), clientv3.WithPrefix())
+	if err != nil {
+		return nil, err
+	}
+	tasks, err := parseetcdv3tasks(prefix, resp)
+	if err != nil {
+		return nil, err
+	}
+	//nil if not claimed
+	return tasks[id], nil
+}
+
+func (c *EtcdV3Coordinator) ListTasks(jobname, stage string) ([]*TaskInfo, error) {
+	tasks := []*TaskInfo{}
+	prefix := jobprefix(jobname) + stage + "/"
+	ctx, cancel := c.context()
+	defer cancel()
+	resp, err := c.client.Get(ctx, prefix, clientv3.WithPrefix())
+	if err != nil {
+		return tasks, err
+	}
+	parsed, err := parseetcdv3tasks(prefix, resp)
+	if err != nil {
+		return tasks, err
+	}
+	for _, task := range parsed {
+		tasks = append(tasks, task)
+	}
+	sort.Sort(tasksbyid(tasks))
+	return tasks, nil
+}
+
+func (c *EtcdV3Coordinator) Results(jobname string) (map[int]string, error) {
+	results := make(map[int]string)
+	prefix := jobprefix(jobname) + "results/"
+	ctx, cancel := c.context()
+	defer cancel()
+	resp, err := c.client.Get(ctx, prefix, clientv3.WithPrefix())
+	if err != nil {
+		return results, err
+	}
+	for _, kv := range resp.Kvs {
+		partitionid, err := strconv.Atoi(strings.TrimPrefix(string(kv.Key), prefix))
+		if err != nil {
+			return results, err
+		}
+		results[partitionid] = string(kv.Value)
+	}
+	return results, nil
+}
+
+func (c *EtcdV3Coordinator) RegisterWorker(info *WorkerInfo, ttl time.Duration) error {
+	b, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := c.context()
+	defer cancel()
+	return putleased(ctx, c.client, workerkey(info.ID), string(b), ttl)
+}
+
+//The parts of clientv3.Client putleased needs
+type leasedkv interface {
+	Get(ctx context.Context, key string, opts ...clientv3.OpOption) (*clientv3.GetResponse, error)
+	Put(ctx context.Context, key, val string, opts ...clientv3.OpOption) (*clientv3.PutResponse, error)
+	Grant(ctx context.Context, ttl int64) (*clientv3.LeaseGrantResponse, error)
+	KeepAliveOnce(ctx context.Context, id clientv3.LeaseID) (*clientv3.LeaseKeepAliveResponse, error)
+}
+
+//Put key, which stays attached to the lease it was first put with and every put keeps alive.
+//A new lease is only granted once the old one expired
+func putleased(ctx context.Context, kv leasedkv, key, value string, ttl time.Duration) error {
+	resp, err := kv.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	var leaseid clientv3.LeaseID
+	if len(resp.Kvs) > 0 && resp.Kvs[0].Lease != 0 {
+		leaseid = clientv3.LeaseID(resp.Kvs[0].Lease)
+		_, err = kv.KeepAliveOnce(ctx, leaseid)
+		if err == rpctypes.ErrLeaseNotFound {
+			leaseid = 0
+		} else if err != nil {
+			return err
+		}
+	}
+	if leaseid == 0 {
+		lease, err := kv.Grant(ctx, int64(ttlseconds(ttl)))
+		if err != nil {
+			return err
+		}
+		leaseid = lease.ID
+	}
+	_, err = kv.Put(ctx, key, value, clientv3.WithLease(leaseid))
+	if err == rpctypes.ErrLeaseNotFound {
+		//Expired right after we renewed it
+		return putleased(ctx, kv, key, value, ttl)
+	}
+	return err
+}
+
+func (c *EtcdV3Coordinator) ListWorkers() ([]*WorkerInfo, error) {
+	ctx, cancel := c.context()
+	defer cancel()
+	resp, err := c.client.Get(ctx, "/gomrworkers/", clientv3.WithPrefix())
+	if err != nil {
+		return nil, err
+	}
+	workers := []*WorkerInfo{}
+	for _, kv := range resp.Kvs {
+		info := &WorkerInfo{}
+		err = json.Unmarshal(kv.Value, info)
+		if err != nil {
+			return nil, err
+		}
+		workers = append(workers, info)
+	}
+	sort.Sort(workersbyid(workers))
+	return workers, nil
+}
+
+func (c *EtcdV3Coordinator) Watch(stop <-chan struct{}) (<-chan struct{}, error) {
+	notify := make(chan struct{}, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	events := c.client.Watch(ctx, "/gomr/", clientv3.WithPrefix(), clientv3.WithPrevKV())
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-stop:
+		case <-done:
+		}
+		cancel()
+	}()
+	go func() {
+		defer close(notify)
+		defer close(done)
+		//The channel is closed once ctx is cancelled or the watch fails for good
+		for resp := range events {
+			if resp.Err() != nil {
+				log.Println("etcd watch ended:", resp.Err())
+				cancel()
+				continue
+			}
+			for _, ev := range resp.Events {
+				var prev *string
+				if ev.PrevKv != nil {
+					value := string(ev.PrevKv.Value)
+					prev = &value
+				}
+				if wakesworkers(string(ev.Kv.Key), string(ev.Kv.Value), prev, ev.Type == clientv3.EventTypeDelete) {
+					signal(notify)
+				}
+			}
+		}
+	}()
+	return notify, nil
+}
+
+func (c *EtcdV3Coordinator) Close() {
+	c.client.Close()
+}
@@ -0,0 +1,130 @@
+package gomr
+
+import (
+	"context"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"testing"
+	"time"
+)
+
+//etcd's default --max-txn-ops
+const etcdmaxtxnops = 128
+
+func TestCompleteTaskTxnOps(t *testing.T) {
+	for _, partitions := range []int{0, 1, 99, 100, 101, 127, 128, 129, 1000} {
+		for _, stage := range []string{StageMap, StageReduce} {
+			outputs := make(map[int]string)
+			for i := 0; i < partitions; i++ {
+				outputs[i] = "output"
+			}
+			total := 0
+			for _, ops := range outputbatches("job", stage, 0, outputs) {
+				if len(ops) == 0 || len(ops) > etcdmaxtxnops {
+					t.Errorf("%s with %d partitions: batch of %d ops", stage, partitions, len(ops))
+				}
+				total += len(ops)
+			}
+			if total != partitions {
+				t.Errorf("%s with %d partitions: %d outputs stored", stage, partitions, total)
+			}
+		}
+	}
+	if len(completeops(taskprefix("job", StageMap, 0))) > etcdmaxtxnops {
+		t.Error("Completing a task takes too many ops")
+	}
+}
+
+//In-memory keys and leases. Put attaches keys to the lease last granted or kept alive, the
+//lease passed with clientv3.WithLease can't be read back
+type fakeleasedkv struct {
+	keys        map[string]*mvccpb.KeyValue
+	leases      map[clientv3.LeaseID]bool
+	last        clientv3.LeaseID
+	grants      int
+	keepalives  int
+	expireonput bool //Expire the lease right before the next put
+}
+
+func newfakeleasedkv() *fakeleasedkv {
+	return &fakeleasedkv{keys: make(map[string]*mvccpb.KeyValue), leases: make(map[clientv3.LeaseID]bool)}
+}
+
+func (kv *fakeleasedkv) Get(ctx context.Context, key string, opts ...clientv3.OpOption) (*clientv3.GetResponse, error) {
+	resp := &clientv3.GetResponse{}
+	if v, ok := kv.keys[key]; ok {
+		resp.Kvs = append(resp.Kvs, v)
+	}
+	return resp, nil
+}
+
+func (kv *fakeleasedkv) Put(ctx context.Context, key, val string, opts ...clientv3.OpOption) (*clientv3.PutResponse, error) {
+	if kv.expireonput {
+		kv.expireonput = false
+		kv.expire(kv.last)
+	}
+	if len(opts) != 1 || !kv.leases[kv.last] {
+		return nil, rpctypes.ErrLeaseNotFound
+	}
+	kv.keys[key] = &mvccpb.KeyValue{Key: []byte(key), Value: []byte(val), Lease: int64(kv.last)}
+	return &clientv3.PutResponse{}, nil
+}
+
+func (kv *fakeleasedkv) Grant(ctx context.Context, ttl int64) (*clientv3.LeaseGrantResponse, error) {
+	kv.grants++
+	kv.last = clientv3.LeaseID(kv.grants)
+	kv.leases[kv.last] = true
+	return &clientv3.LeaseGrantResponse{ID: kv.last, TTL: ttl}, nil
+}
+
+func (kv *fakeleasedkv) KeepAliveOnce(ctx context.Context, id clientv3.LeaseID) (*clientv3.LeaseKeepAliveResponse, error) {
+	if !kv.leases[id] {
+		return nil, rpctypes.ErrLeaseNotFound
+	}
+	kv.keepalives++
+	kv.last = id
+	return &clientv3.LeaseKeepAliveResponse{ID: id}, nil
+}
+
+//Drop a lease and the keys attached to it
+func (kv *fakeleasedkv) expire(id clientv3.LeaseID) {
+	delete(kv.leases, id)
+	for key, v := range kv.keys {
+		if v.Lease == int64(id) {
+			delete(kv.keys, key)
+		}
+	}
+}
+
+func TestPutLeased(t *testing.T) {
+	kv := newfakeleasedkv()
+	put := func(value string) {
+		err := putleased(context.Background(), kv, "/gomrworkers/w", value, time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(kv.keys["/gomrworkers/w"].Value) != value {
+			t.Errorf("Stored %q, want %q", kv.keys["/gomrworkers/w"].Value, value)
+		}
+	}
+	//Heartbeats reuse the first lease
+	for i := 0; i < 3; i++ {
+		put("beat")
+	}
+	if kv.grants != 1 || kv.keepalives != 2 || len(kv.leases) != 1 {
+		t.Errorf("%d grants and %d keep alives for 3 heartbeats, %d leases", kv.grants, kv.keepalives, len(kv.leases))
+	}
+	//A new lease once the old one expired
+	kv.expire(kv.last)
+	put("after expiry")
+	if kv.grants != 2 || kv.keys["/gomrworkers/w"].Lease != 2 {
+		t.Errorf("%d grants after expiry, key on lease %d", kv.grants, kv.keys["/gomrworkers/w"].Lease)
+	}
+	//Expiring between keep alive and put
+	kv.expireonput = true
+	put("expired while putting")
+	if kv.grants != 3 || len(kv.leases) != 1 {
+		t.Errorf("%d grants after expiring while putting, %d leases", kv.grants, len(kv.leases))
+	}
+}
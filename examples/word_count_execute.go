@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"github.com/turbobytes/gomr"
 	"log"
+	"time"
 )
 
 func main() {
@@ -16,6 +17,8 @@ func main() {
 		},
 		Partitions: 5,
 		S3Bucket:   "", //Its blank... so will be picked up from envoirnment
+		//Fetching inputs over http can fail, give each task a few chances
+		Retry: &gomr.RetryPolicy{MaxAttempts: 3, Backoff: 10 * time.Second},
 	}
 	name, err := j.Deploy("word_count") //here word_count is the path to the executable we just built
 	if err != nil {
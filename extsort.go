@@ -0,0 +1,392 @@
+package gomr
+
+import (
+	"bufio"
+	"container/heap"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+)
+
+//Bytes of records a sorter keeps in memory before spilling them to disk, unless the Job says otherwise
+const DefaultSortMemory = 64 << 20
+
+//Rough per record memory overhead on top of key and value
+const recordoverhead = 48
+
+//Most runs merged at once, each takes a file descriptor and a read buffer
+const mergeFanIn = 64
+
+//Sorts records by key using bounded memory.
+//
+//Records are buffered until they exceed the memory limit, then sorted and spilled to a
+//temporary file as a run. Sort merges all runs and whatever is left in memory, first merging
+//groups of runs into larger ones while there are too many to open at once. Values of equal
+//keys keep the order they were added in.
+type ExternalSorter struct {
+	limit   int
+	buf     []record
+	size    int
+	runs    []string                                              //Names of spilled runs, in the order they were spilled
+	open    []*os.File                                            //Runs opened for merging
+	combine func(key string, values *Values, emit EmitFunc) error //Optional - Applied to the records of each key before spilling
+}
+
+//Creates a sorter keeping at most limit bytes of records in memory, DefaultSortMemory if limit is 0
+func NewExternalSorter(limit int) *ExternalSorter {
+	if limit <= 0 {
+		limit = DefaultSortMemory
+	}
+	return &ExternalSorter{limit: limit}
+}
+
+//Add a single record
+func (s *ExternalSorter) Add(key, value string) error {
+	s.buf = append(s.buf, record{key, value})
+	s.size += len(key) + len(value) + recordoverhead
+	if s.size >= s.limit {
+		return s.spill()
+	}
+	return nil
+}
+
+//Add all records from r, which must be in gomr's intermediate record format e.g. from Job.FetchInputS3
+func (s *ExternalSorter) AddReader(r io.Reader) error {
+	br := bufio.NewReader(r)
+	for {
+		rec, err := readrecord(br)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		err = s.Add(rec.key, rec.value)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+//Write buffered records to disk as a sorted run
+func (s *ExternalSorter) spill() error {
+	sort.Stable(recordsbykey(s.buf))
+	if s.combine != nil {
+		combined, err := combinerecords(s.buf, s.combine)
+		if err != nil {
+			return err
+		}
+		s.buf = combined
+	}
+	f, err := ioutil.TempFile("", "gomrsort")
+	if err != nil {
+		return err
+	}
+	s.runs = append(s.runs, f.Name())
+	w := bufio.NewWriter(f)
+	for _, rec := range s.buf {
+		err = writerecord(w, rec.key, rec.value)
+		if err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	cerr := f.Close()
+	if err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	s.buf = nil
+	s.size = 0
+	return nil
+}
+
+//Run combine on each run of equal keys in sorted records
+func combinerecords(records []record, combine func(key string, values *Values, emit EmitFunc) error) ([]record, error) {
+	combined := []record{}
+	emit := func(key, value string) {
+		combined = append(combined, record{key, value})
+	}
+	for i := 0; i < len(records); {
+		key := records[i].key
+		values := &Values{next: func() (string, bool) {
+			if i >= len(records) || records[i].key != key {
+				return "", false
+			}
+			i++
+			return records[i-1].value, true
+		}}
+		err := combine(key, values, emit)
+		if err != nil {
+			return nil, err
+		}
+		//Skip whatever combine didn't consume
+		for values.Next() {
+		}
+	}
+	return combined, nil
+}
+
+//Finish adding records and merge them. The iterator must be closed to remove spilled runs
+func (s *ExternalSorter) Sort() (*GroupIterator, error) {
+	sort.Stable(recordsbykey(s.buf))
+	//Leave room for the records still in memory
+	for len(s.runs) >= mergeFanIn {
+		err := s.mergepass()
+		if err != nil {
+			return nil, err
+		}
+	}
+	//Runs are added in the order they were spilled, records still in memory come last
+	g, err := s.openruns(s.runs)
+	if err != nil {
+		return nil, err
+	}
+	buf := s.buf
+	g.sources = append(g.sources, func() (record, error) {
+		if len(buf) == 0 {
+			return record{}, io.EOF
+		}
+		rec := buf[0]
+		buf = buf[1:]
+		return rec, nil
+	})
+	for src := range g.sources {
+		g.refill(src)
+	}
+	return g, g.err
+}
+
+//Open runs for merging, the iterator's sources are in the same order as runs
+func (s *ExternalSorter) openruns(runs []string) (*GroupIterator, error) {
+	g := &GroupIterator{sorter: s}
+	for _, name := range runs {
+		f, err := os.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		s.open = append(s.open, f)
+		br := bufio.NewReader(f)
+		g.sources = append(g.sources, func() (record, error) {
+			return readrecord(br)
+		})
+	}
+	return g, nil
+}
+
+//Merge every mergeFanIn consecutive runs into a single run
+func (s *ExternalSorter) mergepass() error {
+	merged := []string{}
+	for start := 0; start < len(s.runs); start += mergeFanIn {
+		end := start + mergeFanIn
+		if end > len(s.runs) {
+			end = len(s.runs)
+		}
+		if end-start == 1 {
+			merged = append(merged, s.runs[start])
+			continue
+		}
+		name, err := s.mergeruns(s.runs[start:end])
+		if err != nil {
+			//Keep track of the runs that are left so Close removes them
+			s.runs = append(merged, s.runs[start:]...)
+			return err
+		}
+		merged = append(merged, name)
+	}
+	s.runs = merged
+	return nil
+}
+
+//Merge runs into a new run and remove them
+func (s *ExternalSorter) mergeruns(runs []string) (string, error) {
+	defer s.closeopen()
+	g, err := s.openruns(runs)
+	if err != nil {
+		return "", err
+	}
+	for src := range g.sources {
+		g.refill(src)
+	}
+	f, err := ioutil.TempFile("", "gomrsort")
+	if err != nil {
+		return "", err
+	}
+	w := bufio.NewWriter(f)
+	for err == nil && g.Next() {
+		key, values := g.Key(), g.Values()
+		for err == nil && values.Next() {
+			err = writerecord(w, key, values.Value())
+		}
+	}
+	if err == nil {
+		err = g.Err()
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	cerr := f.Close()
+	if err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	for _, name := range runs {
+		os.Remove(name)
+	}
+	return f.Name(), nil
+}
+
+//Close runs opened for merging
+func (s *ExternalSorter) closeopen() {
+	for _, f := range s.open {
+		f.Close()
+	}
+	s.open = nil
+}
+
+//Remove spilled runs
+func (s *ExternalSorter) Close() error {
+	s.closeopen()
+	var firsterr error
+	for _, name := range s.runs {
+		err := os.Remove(name)
+		if err != nil && firsterr == nil {
+			firsterr = err
+		}
+	}
+	s.runs = nil
+	s.buf = nil
+	return firsterr
+}
+
+//Next record of a run, and which run it came from
+type mergeitem struct {
+	rec record
+	src int
+}
+
+//Min-heap of the next record of every run. Ties go to the earlier run to keep the sort stable
+type mergeheap []mergeitem
+
+func (h mergeheap) Len() int      { return len(h) }
+func (h mergeheap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h mergeheap) Less(i, j int) bool {
+	if h[i].rec.key == h[j].rec.key {
+		return h[i].src < h[j].src
+	}
+	return h[i].rec.key < h[j].rec.key
+}
+func (h *mergeheap) Push(x interface{}) { *h = append(*h, x.(mergeitem)) }
+func (h *mergeheap) Pop() interface{} {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return item
+}
+
+//Walks sorted records one key at a time
+//
+//	for groups.Next() {
+//		key, values := groups.Key(), groups.Values()
+//		...
+//	}
+//	err := groups.Err()
+type GroupIterator struct {
+	sorter  *ExternalSorter
+	sources []func() (record, error)
+	heap    mergeheap
+	key     string
+	values  *Values
+	err     error
+}
+
+//Push the next record of src onto the heap, if it has one
+func (g *GroupIterator) refill(src int) {
+	rec, err := g.sources[src]()
+	if err == io.EOF {
+		return
+	}
+	if err != nil {
+		if g.err == nil {
+			g.err = err
+		}
+		return
+	}
+	heap.Push(&g.heap, mergeitem{rec, src})
+}
+
+//Advances to the next key, false once all keys were visited or on error.
+//Values of the previous key that weren't consumed are skipped
+func (g *GroupIterator) Next() bool {
+	if g.values != nil {
+		for g.values.Next() {
+		}
+	}
+	if g.err != nil || len(g.heap) == 0 {
+		return false
+	}
+	key := g.heap[0].rec.key
+	g.key = key
+	g.values = &Values{next: func() (string, bool) {
+		if g.err != nil || len(g.heap) == 0 || g.heap[0].rec.key != key {
+			return "", false
+		}
+		item := heap.Pop(&g.heap).(mergeitem)
+		g.refill(item.src)
+		return item.rec.value, true
+	}}
+	return true
+}
+
+//The current key
+func (g *GroupIterator) Key() string {
+	return g.key
+}
+
+//Values of the current key
+func (g *GroupIterator) Values() *Values {
+	return g.values
+}
+
+//First error reading spilled runs, if any
+func (g *GroupIterator) Err() error {
+	return g.err
+}
+
+//Remove temporary files
+func (g *GroupIterator) Close() error {
+	return g.sorter.Close()
+}
+
+//Download and sort map outputs in gomr's intermediate record format, as written by EmitWorker.
+//At most Job.SortMemory bytes are kept in memory. The iterator must be closed once done
+func (j *Job) SortInputs(inputs []string) (*GroupIterator, error) {
+	s := NewExternalSorter(j.SortMemory)
+	for _, input := range inputs {
+		rd, err := j.FetchInputS3(input)
+		if err != nil {
+			s.Close()
+			return nil, err
+		}
+		err = s.AddReader(rd)
+		rd.Close()
+		if err != nil {
+			s.Close()
+			return nil, err
+		}
+	}
+	g, err := s.Sort()
+	if err != nil {
+		s.Close()
+		return nil, err
+	}
+	return g, nil
+}
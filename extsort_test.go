@@ -0,0 +1,258 @@
+package gomr
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+//Keys in a scrambled order, each added several times with increasing values
+func testrecords() []record {
+	records := []record{}
+	for round := 0; round < 3; round++ {
+		for i := 0; i < 20; i++ {
+			key := fmt.Sprintf("key%02d", (i*7)%20)
+			records = append(records, record{key, fmt.Sprintf("%s-%d", key, round)})
+		}
+	}
+	return records
+}
+
+//Drain groups into key -> values, checking keys come in order
+func collectgroups(t *testing.T, groups *GroupIterator) ([]string, map[string][]string) {
+	keys := []string{}
+	values := make(map[string][]string)
+	for groups.Next() {
+		key := groups.Key()
+		if len(keys) > 0 && keys[len(keys)-1] >= key {
+			t.Errorf("Key %s after %s", key, keys[len(keys)-1])
+		}
+		keys = append(keys, key)
+		v := groups.Values()
+		for v.Next() {
+			values[key] = append(values[key], v.Value())
+		}
+	}
+	if groups.Err() != nil {
+		t.Error(groups.Err())
+	}
+	return keys, values
+}
+
+func TestExternalSorter(t *testing.T) {
+	tests := []struct {
+		name  string
+		limit int
+		runs  int
+	}{
+		{"in memory", 0, 0},
+		{"spill every record", 1, 60},
+		{"spill every few records", 300, 12},
+	}
+	for _, test := range tests {
+		s := NewExternalSorter(test.limit)
+		for _, rec := range testrecords() {
+			err := s.Add(rec.key, rec.value)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		if len(s.runs) != test.runs {
+			t.Errorf("%s: %d runs, want %d", test.name, len(s.runs), test.runs)
+		}
+		groups, err := s.Sort()
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys, values := collectgroups(t, groups)
+		if len(keys) != 20 {
+			t.Errorf("%s: got %d keys, want 20", test.name, len(keys))
+		}
+		for _, key := range keys {
+			want := []string{key + "-0", key + "-1", key + "-2"}
+			if !reflect.DeepEqual(values[key], want) {
+				t.Errorf("%s: %s has %v, want %v", test.name, key, values[key], want)
+			}
+		}
+		err = groups.Close()
+		if err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestExternalSorterMergePasses(t *testing.T) {
+	//Enough runs for two passes, with a single run left over in the first one
+	n := mergeFanIn*mergeFanIn + 1
+	s := NewExternalSorter(1)
+	defer s.Close()
+	for i := 0; i < n; i++ {
+		err := s.Add(fmt.Sprintf("key%d", i%10), strconv.Itoa(i))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(s.open) != 0 {
+		t.Errorf("%d runs left open after spilling", len(s.open))
+	}
+	groups, err := s.Sort()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.runs) >= mergeFanIn || len(s.open) != len(s.runs) {
+		t.Errorf("Merging %d runs with %d open", len(s.runs), len(s.open))
+	}
+	keys, values := collectgroups(t, groups)
+	if len(keys) != 10 {
+		t.Errorf("Got %d keys, want 10", len(keys))
+	}
+	for _, key := range keys {
+		last := -1
+		for _, value := range values[key] {
+			i, _ := strconv.Atoi(value)
+			if i <= last {
+				t.Fatalf("%s: %d after %d", key, i, last)
+			}
+			last = i
+		}
+		if len(values[key]) != n/10 && len(values[key]) != n/10+1 {
+			t.Errorf("%s has %d values", key, len(values[key]))
+		}
+	}
+	err = groups.Close()
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestExternalSorterSkipValues(t *testing.T) {
+	s := NewExternalSorter(100)
+	defer s.Close()
+	for _, rec := range testrecords() {
+		s.Add(rec.key, rec.value)
+	}
+	groups, err := s.Sort()
+	if err != nil {
+		t.Fatal(err)
+	}
+	//Values that aren't consumed are skipped
+	n := 0
+	for groups.Next() {
+		n++
+	}
+	if n != 20 || groups.Err() != nil {
+		t.Errorf("Got %d keys, %v", n, groups.Err())
+	}
+}
+
+func TestExternalSorterAddReader(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w := bufio.NewWriter(buf)
+	for _, rec := range testrecords() {
+		err := writerecord(w, rec.key, rec.value)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	w.Flush()
+	s := NewExternalSorter(200)
+	defer s.Close()
+	err := s.AddReader(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	groups, err := s.Sort()
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, values := collectgroups(t, groups)
+	if len(keys) != 20 || len(values["key07"]) != 3 {
+		t.Errorf("Got %v %v", keys, values)
+	}
+}
+
+//Sums integer values
+func sumcombine(key string, values *Values, emit EmitFunc) error {
+	sum := 0
+	for values.Next() {
+		n, err := strconv.Atoi(values.Value())
+		if err != nil {
+			return err
+		}
+		sum += n
+	}
+	emit(key, strconv.Itoa(sum))
+	return nil
+}
+
+func TestExternalSorterCombine(t *testing.T) {
+	tests := []struct {
+		name  string
+		limit int
+	}{
+		{"in memory", 0},
+		{"spill every record", 1},
+		{"spill every few records", 200},
+	}
+	for _, test := range tests {
+		s := NewExternalSorter(test.limit)
+		s.combine = sumcombine
+		for round := 1; round <= 3; round++ {
+			for i := 0; i < 10; i++ {
+				err := s.Add(fmt.Sprintf("key%d", (i*3)%10), strconv.Itoa(round))
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+		groups, err := s.Sort()
+		if err != nil {
+			t.Fatal(err)
+		}
+		//Runs were combined when spilled, combine once more across them like EmitWorker does
+		sums := make(map[string]string)
+		for groups.Next() {
+			err = sumcombine(groups.Key(), groups.Values(), func(key, value string) {
+				sums[key] = value
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		if len(sums) != 10 {
+			t.Errorf("%s: got %d keys, want 10", test.name, len(sums))
+		}
+		for key, sum := range sums {
+			if sum != "6" {
+				t.Errorf("%s: %s sums to %s, want 6", test.name, key, sum)
+			}
+		}
+		groups.Close()
+	}
+}
+
+func TestCombineRecords(t *testing.T) {
+	records := []record{{"a", "1"}, {"a", "2"}, {"b", "3"}, {"c", "4"}, {"c", "5"}, {"c", "6"}}
+	combined, err := combinerecords(records, sumcombine)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []record{{"a", "3"}, {"b", "3"}, {"c", "15"}}
+	if !reflect.DeepEqual(combined, want) {
+		t.Errorf("Got %v, want %v", combined, want)
+	}
+	//A combiner only looking at the first value
+	first := func(key string, values *Values, emit EmitFunc) error {
+		values.Next()
+		emit(key, values.Value())
+		return nil
+	}
+	combined, err = combinerecords(records, first)
+	want = []record{{"a", "1"}, {"b", "3"}, {"c", "4"}}
+	if err != nil || !reflect.DeepEqual(combined, want) {
+		t.Errorf("Got %v %v, want %v", combined, err, want)
+	}
+}
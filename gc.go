@@ -0,0 +1,155 @@
+package gomr
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"time"
+)
+
+//Retention rules applied by GC
+type GCPolicy struct {
+	DeleteIntermediate bool          //Delete map outputs of finished jobs, results are kept
+	MaxAge             time.Duration //Delete finished jobs entirely once they are older than this. 0 keeps them forever
+	DeleteBinaries     bool          //Delete bin/<sha256> binaries no job refers to. Don't use while jobs are being submitted, their binary may not be referenced yet
+}
+
+//Whether the job will not run any more tasks
+func finished(status int) bool {
+	return status == StatusDone || status == StatusFail || status == StatusCancelled
+}
+
+//Delete every object under prefix
+func deleteprefix(store BlobStore, prefix string) error {
+	keys, err := store.List(prefix)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		err = store.Delete(key)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//Delete a finished job, its job data, intermediate and result objects and coordinator state.
+//Running jobs must be cancelled first. The binary is left alone since other jobs may use it, GC takes care of that
+func DeleteJob(jobname string) error {
+	env := NewEnvironment()
+	co, err := env.GetCoordinator()
+	if err != nil {
+		return err
+	}
+	defer co.Close()
+	return deletejob(env, co, jobname)
+}
+
+func deletejob(env *Environment, co Coordinator, jobname string) error {
+	info, err := co.GetJob(jobname)
+	if err != nil {
+		return err
+	}
+	if !finished(info.Status) {
+		return errors.New("Job '" + jobname + "' is still running, cancel it first")
+	}
+	//A prefix without the trailing slash would match other jobs as well
+	if !strings.HasSuffix(info.S3Prefix, "/"+jobname+"/") {
+		return errors.New("Refusing to delete objects under unexpected prefix '" + info.S3Prefix + "'")
+	}
+	store, err := env.GetBlobStore(info.S3Bucket)
+	if err != nil {
+		return err
+	}
+	//Objects first, so a failure leaves the job around to retry the deletion
+	err = deleteprefix(store, info.S3Prefix)
+	if err != nil {
+		return err
+	}
+	return co.DeleteJob(jobname)
+}
+
+//Delete this job from the environment it lives in, e.g. that of its LocalRunner
+func (j *Job) Delete() error {
+	env := j.environment()
+	co, err := env.GetCoordinator()
+	if err != nil {
+		return err
+	}
+	defer co.Close()
+	return deletejob(env, co, j.Name)
+}
+
+//Apply policy to all jobs, then remove binaries no remaining job refers to if asked to.
+//Jobs which haven't finished are never touched
+func GC(policy GCPolicy) error {
+	env := NewEnvironment()
+	co, err := env.GetCoordinator()
+	if err != nil {
+		return err
+	}
+	defer co.Close()
+	names, err := co.ListJobs()
+	if err != nil {
+		return err
+	}
+	//bucket -> binaries still in use
+	referenced := make(map[string]map[string]bool)
+	if env.S3_BUCKET != "" {
+		referenced[env.S3_BUCKET] = make(map[string]bool)
+	}
+	for _, name := range names {
+		info, err := co.GetJob(name)
+		if err != nil {
+			return err
+		}
+		//Buckets of deleted jobs are checked for binaries as well
+		if referenced[info.S3Bucket] == nil {
+			referenced[info.S3Bucket] = make(map[string]bool)
+		}
+		if finished(info.Status) && policy.MaxAge > 0 && time.Since(info.CreatedAt) > policy.MaxAge {
+			log.Println("Deleting job", name, "created at", info.CreatedAt)
+			err = deletejob(env, co, name)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		referenced[info.S3Bucket][info.Binary] = true
+		if finished(info.Status) && policy.DeleteIntermediate {
+			store, err := env.GetBlobStore(info.S3Bucket)
+			if err != nil {
+				return err
+			}
+			log.Println("Deleting intermediate outputs of", name)
+			err = deleteprefix(store, info.S3Prefix+"maps/")
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if !policy.DeleteBinaries {
+		return nil
+	}
+	for bucket, inuse := range referenced {
+		store, err := env.GetBlobStore(bucket)
+		if err != nil {
+			return err
+		}
+		keys, err := store.List("bin/")
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			if !inuse[key] {
+				log.Println("Deleting unreferenced binary", bucket, key)
+				err = store.Delete(key)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package gomr
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestDeleteJob(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gomr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	tests := []struct {
+		name    string
+		prefix  string
+		cancel  bool
+		deleted bool
+	}{
+		{"running", "/job/", false, false},
+		{"cancelled", "/job/", true, true},
+		{"prefix without slash", "/job", true, false},
+		{"other prefix", "/other/", true, false},
+	}
+	for _, test := range tests {
+		env := &Environment{BLOBSTORE: "local", LOCALSTORE_PATH: dir, COORDINATOR: "memory", S3_BUCKET: "local", memory: NewMemoryCoordinator()}
+		co := env.memory
+		store, err := env.GetBlobStore("local")
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys := []string{"/job/jobdata.json", "/job/maps/0-a", "/jobs/jobdata.json", "/other/jobdata.json"}
+		for _, key := range keys {
+			err = store.Put(key, strings.NewReader("data"), 4, "text/plain")
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		err = co.CreateJob(&JobInfo{Name: "job", S3Bucket: "local", S3Prefix: test.prefix, Status: StatusMapStage})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if test.cancel {
+			err = co.CancelJob("job")
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		err = (&Job{Name: "job", env: env}).Delete()
+		if (err == nil) != test.deleted {
+			t.Errorf("%s: got %v", test.name, err)
+		}
+		_, geterr := co.GetJob("job")
+		if (geterr != nil) != test.deleted {
+			t.Errorf("%s: job still exists %v", test.name, geterr == nil)
+		}
+		//Other jobs are never touched
+		for _, key := range keys {
+			exists, err := store.Exists(key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := !test.deleted || !strings.HasPrefix(key, "/job/")
+			if exists != want {
+				t.Errorf("%s: %s exists %v, want %v", test.name, key, exists, want)
+			}
+		}
+	}
+}
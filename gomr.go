@@ -1,6 +1,7 @@
 package gomr
 
 import (
+	"bytes"
 	"compress/gzip"
 	"crypto/sha256"
 	"encoding/hex"
@@ -16,7 +17,6 @@ import (
 	"log"
 	"os"
 	"sort"
-	"strconv"
 	"strings"
 	"time"
 )
@@ -27,8 +27,28 @@ const (
 	StatusReduceStage = 2
 	StatusFail        = 3
 	StatusDone        = 4
+	StatusCancelled   = 5
 )
 
+//Human readable name of a job status
+func StatusText(status int) string {
+	switch status {
+	case StatusInitialized:
+		return "Initialized"
+	case StatusMapStage:
+		return "MapStage"
+	case StatusReduceStage:
+		return "ReduceStage"
+	case StatusFail:
+		return "Failed"
+	case StatusDone:
+		return "Done"
+	case StatusCancelled:
+		return "Cancelled"
+	}
+	return "Unknown"
+}
+
 //Sortable list
 type Joblist []*Job
 
@@ -40,6 +60,7 @@ func (a Joblist) Less(i, j int) bool { return a[i].CreatedAt.Before(a[j].Created
 type Worker struct {
 	Map    func(input string, job *Job, logger Logger) (map[int]string, error)
 	Reduce func(inputs []string, partition int, job *Job, logger Logger) (string, error)
+	Sample func(inputs []string, job *Job, logger Logger) ([]string, error) //Optional - Computes range split points from a sample of the inputs, needed for jobs with SampleFraction set
 }
 
 func gzipfile(fname string, output io.WriteCloser) error {
@@ -68,69 +89,84 @@ type StageProgress struct {
 	Failed  int //Tasks failed
 }
 
-func (p *StageProgress) update(resp *etcd.Response) error {
-	for _, node := range resp.Node.Nodes {
-		for _, subnode := range node.Nodes {
-			if strings.HasSuffix(subnode.Key, "status") {
-				status, err := strconv.Atoi(subnode.Value)
-				if err != nil {
-					return err
-				}
-				//log.Println(status)
-				switch status {
-				case StatusInitialized:
-					p.Running++
-				case StatusDone:
-					p.Done++
-				case StatusFail:
-					p.Failed++
-				}
+func (p *StageProgress) update(tasks []*TaskInfo) {
+	for _, task := range tasks {
+		switch task.Status {
+		case StatusInitialized:
+			//Tasks whose lease expired are waiting to be reclaimed
+			if task.Leased {
+				p.Running++
 			}
-			//log.Println(subnode.Key)
+		case StatusDone:
+			p.Done++
+		case StatusFail:
+			p.Failed++
 		}
 	}
 	p.Waiting = p.Total - (p.Done + p.Failed + p.Running)
-	return nil
 }
 
 type Job struct {
 	Params         map[string]interface{} //Arbitary Kv - must be json encodable
 	NamePrefix     string                 //Optional - single word, only alphanumeric
 	Name           string                 //NamePrefix + some uuid. Generated automatically
-	Inputs         []string               //List of inputs, this should be something that makes sense to the map stage
-	Partitions     int                    //Number of partitions desired... this is sent to map/reduce stage and can be ignored.
-	Status         int                    //StatusInitialized or StatusMapStage or StatusReduceStage or StatusFail or StatusDone
+	Inputs         []string               //List of inputs, this should be something that makes sense to the map stage. Globs and prefixes are expanded by Deploy, see Environment.ExpandInputs
+	Partitions     int                    //Number of partitions desired... EmitWorker partitions map outputs into this many, Worker can ignore it.
+	Partitioner    string                 //Optional - Name of the Partitioner EmitWorker uses. "hash" (default), "range" or one added with RegisterPartitioner
+	SplitPoints    []string               //Split points of the "range" partitioner
+	SampleFraction float64                //Optional - Fraction of Inputs sampled before the map stage to compute SplitPoints, so results concatenated in partition order are globally sorted. Implies the "range" partitioner
+	Status         int                    //StatusInitialized or StatusMapStage or StatusReduceStage or StatusFail or StatusDone or StatusCancelled
 	Results        []string               //Populated once job is complete
+	ResultParts    []int                  //Partition of each of Results, populated with them. See OpenResults
 	S3Bucket       string                 //S3 Bucket name
 	S3Prefix       string                 // /Job.Name/ gets appended
 	BinaryFile     string                 //Path to binary file - auto created
 	NumMaps        int                    //Number of inputs for map stage a.k.a. len(Inputs)
 	NumReduces     int                    //Number of inputs for reduce stage - populated once all map have finished
 	CreatedAt      time.Time              //Timestamp of when the Job was initially submitted - used for sorting
+	LeaseTTL       time.Duration          //Optional - How long a task stays claimed without heartbeats from its worker. Defaults to DefaultLeaseTTL
+	Retry          *RetryPolicy           //Optional - How often failing tasks are attempted. Defaults to a single attempt
+	MaxFailedTasks int                    //Optional - How many tasks may run out of attempts before the whole job fails. Their outputs are skipped. Defaults to 0
+	SortMemory     int                    //Optional - Bytes of records a reducer sorts in memory before spilling to disk. Defaults to DefaultSortMemory
+	SplitSize      int64                  //Optional - Target bytes per map task. Large inputs are split and small ones grouped by the InputFormat, Map reads its input with Job.OpenInput. 0 keeps one map task per input
+	OutputFormat   string                 //Optional - Format of the results written by EmitWorker, OutputTSV by default. See ExportResults
+	InputFormat    string                 //Optional - Name of the InputFormat splitting inputs. "lines" (default), "whole" or one added with RegisterInputFormat
+	FailReason     string                 //Populated if the job failed
+	FailedTask     string                 //Populated if the job failed - the task that caused it, as <stage>/<id>
 	MapProgress    *StageProgress
 	ReduceProgress *StageProgress
+	cancelled      int32        //Set by the heartbeat once the job got cancelled while a task runs
+	env            *Environment //Where the job lives, the process environment unless run by LocalRunner
+}
+
+//Environment the job lives in
+func (j *Job) environment() *Environment {
+	if j.env != nil {
+		return j.env
+	}
+	return NewEnvironment()
 }
 
 //Fetch all jobs, but only their status is populated, this is done to not access S3 where the real initial job is stored
 func FetchAllJobs() (Joblist, error) {
 	jobs := []*Job{}
 	env := NewEnvironment()
-	cl := env.GetEtcdClient()
-	defer cl.Close()
-	resp, err := cl.Get("/gomr/", false, true)
+	co, err := env.GetCoordinator()
 	if err != nil {
 		return jobs, err
 	}
-	for _, node := range resp.Node.Nodes {
-		splitted := strings.Split(node.Key, "/")
-		if len(splitted) == 3 {
-			j := &Job{Name: splitted[2]}
-			err = j.UpdateStatus()
-			if err != nil {
-				return jobs, err
-			}
-			jobs = append(jobs, j)
+	defer co.Close()
+	names, err := co.ListJobs()
+	if err != nil {
+		return jobs, err
+	}
+	for _, name := range names {
+		j := &Job{Name: name}
+		err = j.updatestatus(co)
+		if err != nil {
+			return jobs, err
 		}
+		jobs = append(jobs, j)
 	}
 	sortedjobs := Joblist(jobs)
 	sort.Sort(sort.Reverse(sortedjobs))
@@ -141,27 +177,22 @@ func FetchJob(jobname string) (*Job, error) {
 	j := &Job{}
 	env := NewEnvironment()
 	//Get job data
-	cl := env.GetEtcdClient()
-	defer cl.Close()
-	eprefix := "/gomr/" + jobname + "/"
-
-	resp, err := cl.Get(eprefix+"s3bucket", false, true)
+	co, err := env.GetCoordinator()
 	if err != nil {
 		return nil, err
 	}
-	s3bucket := resp.Node.Value
-	log.Println("s3bucket", s3bucket)
-	resp, err = cl.Get(eprefix+"s3prefix", false, true)
+	defer co.Close()
+	info, err := co.GetJob(jobname)
 	if err != nil {
 		return nil, err
 	}
-	s3prefix := resp.Node.Value
-	log.Println("s3prefix", s3prefix)
-	bucket, err := env.GetS3Bucket(s3bucket)
+	log.Println("s3bucket", info.S3Bucket)
+	log.Println("s3prefix", info.S3Prefix)
+	store, err := env.GetBlobStore(info.S3Bucket)
 	if err != nil {
 		return nil, err
 	}
-	data, err := bucket.Get(s3prefix + "jobdata.json")
+	data, err := store.Get(info.S3Prefix + "jobdata.json")
 	if err != nil {
 		return nil, err
 	}
@@ -171,7 +202,7 @@ func FetchJob(jobname string) (*Job, error) {
 	if err != nil {
 		return nil, err
 	}
-	err = j.UpdateStatus()
+	err = j.updatestatus(co)
 	if err != nil {
 		return nil, err
 	}
@@ -180,86 +211,68 @@ func FetchJob(jobname string) (*Job, error) {
 
 //Update Job Status
 func (j *Job) UpdateStatus() error {
-	//Populate status info
-	env := NewEnvironment()
-	//Get job data
-	cl := env.GetEtcdClient()
-	defer cl.Close()
-	eprefix := "/gomr/" + j.Name + "/"
-	resp, err := cl.Get(eprefix+"status", false, false)
-	if err != nil {
-		return err
-	}
-	status, err := strconv.Atoi(resp.Node.Value)
+	env := j.environment()
+	co, err := env.GetCoordinator()
 	if err != nil {
 		return err
 	}
-	j.Status = status
-	//Populate NumMaps and NumReduces
-	resp, err = cl.Get(eprefix+"nummaps", false, false)
-	if err != nil {
-		return err
-	}
-	j.NumMaps, err = strconv.Atoi(resp.Node.Value)
+	defer co.Close()
+	return j.updatestatus(co)
+}
+
+func (j *Job) updatestatus(co Coordinator) error {
+	//Populate status info
+	info, err := co.GetJob(j.Name)
 	if err != nil {
 		return err
 	}
+	j.Status = info.Status
 	//Populate NumMaps and NumReduces
-	resp, err = cl.Get(eprefix+"numreduces", false, false)
-	if err != nil {
-		return err
-	}
-	j.NumReduces, err = strconv.Atoi(resp.Node.Value)
-	if err != nil {
-		return err
-	}
+	j.NumMaps = info.NumMaps
+	j.NumReduces = info.NumReduces
+	//Update CreatedAt, in-case this is not the full S3 json
+	j.CreatedAt = info.CreatedAt
+	j.FailReason = info.FailReason
+	j.FailedTask = info.FailedTask
+
 	//Populate StageProgress
 	j.MapProgress = &StageProgress{Total: j.NumMaps}
 	j.ReduceProgress = &StageProgress{Total: j.NumReduces}
-
-	resp, err = cl.Get(eprefix+"map", false, true)
-	if err != nil {
-		return err
-	}
-	err = j.MapProgress.update(resp)
-	if err != nil {
-		return err
-	}
-
-	resp, err = cl.Get(eprefix+"reduce", false, true)
-	if err != nil {
-		return err
-	}
-	err = j.ReduceProgress.update(resp)
-	if err != nil {
-		return err
-	}
-
-	//Update CreatedAt, in-case this is not the full S3 json
-	resp, err = cl.Get(eprefix+"createdat", false, false)
+	tasks, err := co.ListTasks(j.Name, StageMap)
 	if err != nil {
 		return err
 	}
-	j.CreatedAt, err = time.Parse(time.RFC3339, resp.Node.Value)
+	j.MapProgress.update(tasks)
+	tasks, err = co.ListTasks(j.Name, StageReduce)
 	if err != nil {
 		return err
 	}
+	j.ReduceProgress.update(tasks)
 
 	//Populate results
-	if status == StatusDone {
-		resp, err = cl.Get(eprefix+"results", false, false)
-		for _, node := range resp.Node.Nodes {
-			//log.Println(node.Key, node.Value)
-			j.Results = append(j.Results, node.Value)
+	if j.Status == StatusDone {
+		results, err := co.Results(j.Name)
+		if err != nil {
+			return err
+		}
+		partitions := []int{}
+		for partition, _ := range results {
+			partitions = append(partitions, partition)
 		}
+		sort.Ints(partitions)
+		j.Results = []string{}
+		for _, partition := range partitions {
+			j.Results = append(j.Results, results[partition])
+		}
+		j.ResultParts = partitions
 	}
 	return nil
 }
 
 //Fetch results of this job into localfile
 func (j *Job) FetchResults(fname string) error {
-	env := NewEnvironment()
-	bucket, err := env.GetS3Bucket(j.S3Bucket)
+	env := j.environment()
+	store, err := env.GetBlobStore(j.S3Bucket)
 	if err != nil {
 		return err
 	}
@@ -270,59 +283,59 @@ func (j *Job) FetchResults(fname string) error {
 	defer f.Close()
 	for _, result := range j.Results {
 		log.Println("Fetching:", result)
-		rd, err := bucket.GetReader(result)
+		rd, err := store.GetReader(result)
 		if err != nil {
 			return err
 		}
 		gzrd, err := gzip.NewReader(rd)
 		if err != nil {
+			rd.Close()
 			return err
 		}
 		_, err = io.Copy(f, gzrd)
 		gzrd.Close()
 		rd.Close()
+		if err != nil {
+			return err
+		}
 	}
-	return nil
+	return f.Close()
 }
 
 type Task struct {
 	Binary     string
 	JobName    string
 	BucketName string
+	Waiting    int //Tasks of the current stage that could be claimed right now
+
+	worker string //ID of the WorkerDaemon running the task, if any
 }
 
 //Return list of jobnames that arent complete...
 func GetIncompleteJobs() ([]*Task, error) {
 	jobs := []*Task{}
 	env := NewEnvironment()
-	cl := env.GetEtcdClient()
-	defer cl.Close()
-	resp, err := cl.Get("/gomr", false, false)
+	co, err := env.GetCoordinator()
+	if err != nil {
+		return jobs, err
+	}
+	defer co.Close()
+	names, err := co.ListJobs()
 	if err != nil {
 		return jobs, err
 	}
-	for _, node := range resp.Node.Nodes {
+	for _, name := range names {
 		//Check if this job is finished or not...
-		resp, err = cl.Get(node.Key+"/status", false, false)
+		info, err := co.GetJob(name)
 		if err != nil {
 			return jobs, err
 		}
-		status, err := strconv.Atoi(resp.Node.Value)
-		if err != nil {
-			return jobs, err
-		}
-		if status != StatusDone {
-			splitted := strings.Split(node.Key, "/")
-			key := splitted[len(splitted)-1]
-			resp, err = cl.Get(node.Key+"/bin", false, false)
-			if err != nil {
-				return jobs, err
-			}
-			resp1, err := cl.Get(node.Key+"/s3bucket", false, false)
+		if info.Status != StatusDone && info.Status != StatusFail && info.Status != StatusCancelled {
+			waiting, err := waitingtasks(co, info)
 			if err != nil {
 				return jobs, err
 			}
-			jobs = append(jobs, &Task{resp.Node.Value, key, resp1.Node.Value})
+			jobs = append(jobs, &Task{Binary: info.Binary, JobName: name, BucketName: info.S3Bucket, Waiting: waiting})
 		}
 	}
 	return jobs, nil
@@ -341,7 +354,7 @@ func sha256sum(binfile string) (string, error) {
 	return hex.EncodeToString(hasher.Sum(nil)), nil
 }
 
-func uploads3file(path, file, contenttype string, bucket *s3.Bucket) error {
+func uploadfile(path, file, contenttype string, store BlobStore) error {
 	f, err := os.Open(file)
 	if err != nil {
 		return err
@@ -351,7 +364,7 @@ func uploads3file(path, file, contenttype string, bucket *s3.Bucket) error {
 	if err != nil {
 		return err
 	}
-	err = bucket.PutReader(path, f, info.Size(), contenttype, s3.Private)
+	err = store.Put(path, f, info.Size(), contenttype)
 	if err != nil {
 		return err
 	}
@@ -359,15 +372,18 @@ func uploads3file(path, file, contenttype string, bucket *s3.Bucket) error {
 }
 
 //Uploads only if the given key does not exist
-func uploads3fileifnotexists(binpath, binfile, contenttype string, bucket *s3.Bucket) error {
-	k, _ := bucket.GetKey(binpath)
-	if k == nil {
-		//Binary does not exist on s3.. gzip and upload it now...
+func uploadfileifnotexists(binpath, binfile, contenttype string, store BlobStore) error {
+	exists, err := store.Exists(binpath)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		//Binary does not exist in the store.. gzip and upload it now...
 		finalfile, err := gziptotempfile(binfile)
 		if err != nil {
 			return err
 		}
-		return uploads3file(binpath, finalfile, "application/x-gzip", bucket)
+		return uploadfile(binpath, finalfile, "application/x-gzip", store)
 	}
 	return nil
 }
@@ -387,8 +403,8 @@ func gziptotempfile(fname string) (string, error) {
 
 //Compress and upload output to given path. deleting the source file
 func (j *Job) uploadoutput(fname string, path string) (string, error) {
-	env := NewEnvironment()
-	bucket, err := env.GetS3Bucket(j.S3Bucket)
+	env := j.environment()
+	store, err := env.GetBlobStore(j.S3Bucket)
 	if err != nil {
 		return "", err
 	}
@@ -397,17 +413,18 @@ func (j *Job) uploadoutput(fname string, path string) (string, error) {
 	if err != nil {
 		return "", err
 	}
+	//Delete the temporary file whether or not the upload worked...
+	defer os.Remove(gzfile.Name())
+	defer gzfile.Close()
 	err = gzipfile(fname, gzfile)
 	if err != nil {
 		return "", err
 	}
 	os.Remove(fname)
-	err = uploads3file(path, gzfile.Name(), "application/x-gzip", bucket)
+	err = uploadfile(path, gzfile.Name(), "application/x-gzip", store)
 	if err != nil {
 		return "", err
 	}
-	//Delete the temporary file...
-	os.Remove(fname)
 	return path, nil
 }
 
@@ -422,12 +439,12 @@ func (j *Job) UploadResultS3(fname string) (string, error) {
 }
 
 func (j *Job) FetchInputS3(path string) (rc io.ReadCloser, err error) {
-	env := NewEnvironment()
-	bucket, err := env.GetS3Bucket(j.S3Bucket)
+	env := j.environment()
+	store, err := env.GetBlobStore(j.S3Bucket)
 	if err != nil {
 		return nil, err
 	}
-	rd, err := bucket.GetReader(path)
+	rd, err := store.GetReader(path)
 	if err != nil {
 		return nil, err
 	}
@@ -436,12 +453,6 @@ func (j *Job) FetchInputS3(path string) (rc io.ReadCloser, err error) {
 
 //Deploy job things to S3 and initialize etcd keys.
 func (j *Job) Deploy(binfile string) (string, error) {
-	u := uuid.NewV4()
-	prefix := ""
-	if j.NamePrefix != "" {
-		prefix = j.NamePrefix + "-"
-	}
-	j.Name = fmt.Sprintf("%s%s", prefix, u)
 	//Get name of binary file
 	var err error
 	j.BinaryFile, err = sha256sum(binfile)
@@ -449,176 +460,146 @@ func (j *Job) Deploy(binfile string) (string, error) {
 		return "", err
 	}
 
-	//Upload binary to s3...
+	//Upload binary to the blob store...
 	env := NewEnvironment()
 	if j.S3Bucket == "" {
 		j.S3Bucket = env.S3_BUCKET
 	}
-	bucket, err := env.GetS3Bucket(j.S3Bucket)
+	store, err := env.GetBlobStore(j.S3Bucket)
 	if err != nil {
 		return "", err
 	}
 	binpath := "bin/" + j.BinaryFile
 	//Check if file already exists... without downloading
-	err = uploads3fileifnotexists(binpath, binfile, "application/octet-stream", bucket)
+	err = uploadfileifnotexists(binpath, binfile, "application/octet-stream", store)
 	if err != nil {
 		return "", err
 	}
-
-	//Insert timestamp
-	j.CreatedAt = time.Now()
-
-	//Calculate NumMaps
-	j.NumMaps = len(j.Inputs)
-
-	//Upload job json to s3...
-	//TODO: Gzip before upload...
-	j.S3Prefix = fmt.Sprintf("%s/%s/", j.S3Prefix, j.Name)
-	b, err := json.Marshal(j)
-	if err != nil {
-		return "", err
-	}
-	err = bucket.Put(j.S3Prefix+"jobdata.json", b, "application/json", s3.Private)
+	err = j.register(env, store, binpath)
 	if err != nil {
 		return "", err
 	}
+	return j.Name, nil
+}
 
-	//TODO: Create etcd keys...
-
-	cl := env.GetEtcdClient()
-	defer cl.Close()
-	eprefix := "/gomr/" + j.Name + "/"
-	//Create directory
-	_, err = cl.CreateDir(eprefix, 0)
-	if err != nil {
-		return "", err
-	}
-	//Add job metadata
-	_, err = cl.Create(eprefix+"status", strconv.Itoa(j.Status), 0)
-	if err != nil {
-		return "", err
+//Name the job, store its job data and create it in the coordinator
+func (j *Job) register(env *Environment, store BlobStore, binpath string) error {
+	u := uuid.NewV4()
+	prefix := ""
+	if j.NamePrefix != "" {
+		prefix = j.NamePrefix + "-"
 	}
+	j.Name = fmt.Sprintf("%s%s", prefix, u)
 
-	//Add job binary info
-	_, err = cl.Create(eprefix+"bin", binpath, 0)
-	if err != nil {
-		return "", err
-	}
+	//Insert timestamp
+	j.CreatedAt = time.Now()
 
-	//S3 bucket we are using
-	_, err = cl.Create(eprefix+"s3bucket", j.S3Bucket, 0)
+	//Expand globs and prefixes, the resolved list is stored in jobdata.json
+	inputs, err := env.ExpandInputs(j.Inputs)
 	if err != nil {
-		return "", err
+		return err
 	}
+	j.Inputs = inputs
 
-	//S3 prefix
-	_, err = cl.Create(eprefix+"s3prefix", j.S3Prefix, 0)
+	err = checkoutputformat(j.OutputFormat)
 	if err != nil {
-		return "", err
+		return err
 	}
 
-	//Store CreatedAt
-	_, err = cl.Create(eprefix+"createdat", j.CreatedAt.Format(time.RFC3339), 0)
-	if err != nil {
-		return "", err
+	//Split large inputs and group small ones into map tasks
+	if j.SplitSize > 0 {
+		format, err := j.GetInputFormat()
+		if err != nil {
+			return err
+		}
+		j.Inputs, err = env.planinputs(format, j.Inputs, j.SplitSize)
+		if err != nil {
+			return err
+		}
 	}
 
-	//Store NumMaps
-	_, err = cl.Create(eprefix+"nummaps", strconv.Itoa(j.NumMaps), 0)
-	if err != nil {
-		return "", err
-	}
+	//Calculate NumMaps
+	j.NumMaps = len(j.Inputs)
 
-	//Store NumReduces - this will be 0 for now
-	_, err = cl.Create(eprefix+"numreduces", strconv.Itoa(j.NumReduces), 0)
+	//Upload job json to s3...
+	//TODO: Gzip before upload...
+	j.S3Prefix = fmt.Sprintf("%s/%s/", j.S3Prefix, j.Name)
+	b, err := json.Marshal(j)
 	if err != nil {
-		return "", err
+		return err
 	}
-
-	//Create directory for maps
-	_, err = cl.CreateDir(eprefix+"map/", 0)
+	err = store.Put(j.S3Prefix+"jobdata.json", bytes.NewReader(b), int64(len(b)), "application/json")
 	if err != nil {
-		return "", err
+		return err
 	}
 
-	//Create directory for reduce
-	_, err = cl.CreateDir(eprefix+"reduce/", 0)
+	co, err := env.GetCoordinator()
 	if err != nil {
-		return "", err
+		return err
 	}
-
-	//Create directory for results
-	_, err = cl.CreateDir(eprefix+"results/", 0)
+	defer co.Close()
+	err = co.CreateJob(&JobInfo{
+		Name:       j.Name,
+		Status:     j.Status,
+		Binary:     binpath,
+		S3Bucket:   j.S3Bucket,
+		S3Prefix:   j.S3Prefix,
+		CreatedAt:  j.CreatedAt,
+		NumMaps:    j.NumMaps,
+		NumReduces: j.NumReduces,
+	})
 	if err != nil {
-		return "", err
+		return err
 	}
-
-	/*
-		//Create individual map tasks
-		for i, input := range j.Inputs {
-			//Create directory for map task
-			_, err = cl.CreateDir(eprefix+"map/"+strconv.Itoa(i)+"/", 0)
-			if err != nil {
-				return "", err
-			}
-			//Write input url
-			_, err = cl.Create(eprefix+"map/"+strconv.Itoa(i)+"/"+"input", input, 0)
-			if err != nil {
-				return "", err
-			}
-		}
-	*/
 	j.Status = StatusInitialized
-	return j.Name, err
+	j.env = env
+	return nil
 }
 
 //Fetch a task to do and run it
 func (w *Worker) Execute(jobname string) {
+	w.execute(NewEnvironment(), jobname)
+}
+
+func (w *Worker) execute(env *Environment, jobname string) {
 	log.Println("Doing...", jobname)
 	log.Println("Looking for map jobs...")
-	env := NewEnvironment()
 	logger := env.GetLogger([]string{jobname})
 	defer logger.Close()
 	//Get job data
-	cl := env.GetEtcdClient()
-	defer cl.Close()
-	eprefix := "/gomr/" + jobname + "/"
-	//Check if job is already completed... if so then abort...
-	resp, err := cl.Get(eprefix+"status", false, false)
+	co, err := env.GetCoordinator()
 	if err != nil {
 		logger.Critical(err)
 		return
 	}
-	status, err := strconv.Atoi(resp.Node.Value)
+	defer co.Close()
+	info, err := co.GetJob(jobname)
 	if err != nil {
 		logger.Critical(err)
 		return
 	}
-	if status == StatusDone {
+	//Check if job is already completed... if so then abort...
+	if info.Status == StatusDone {
 		logger.Info("Job is already done...")
 		return
 	}
-
-	resp, err = cl.Get(eprefix+"s3bucket", false, true)
-	if err != nil {
-		logger.Critical(err)
+	if info.Status == StatusFail {
+		logger.Info("Job has failed:", info.FailReason)
 		return
 	}
-	s3bucket := resp.Node.Value
-	logger.Info("s3bucket", s3bucket)
-	resp, err = cl.Get(eprefix+"s3prefix", false, true)
-	if err != nil {
-		logger.Critical(err)
+	if info.Status == StatusCancelled {
+		logger.Info("Job was cancelled...")
 		return
 	}
-	s3prefix := resp.Node.Value
-	logger.Info("s3prefix", s3prefix)
-	bucket, err := env.GetS3Bucket(s3bucket)
+
+	logger.Info("s3bucket", info.S3Bucket)
+	logger.Info("s3prefix", info.S3Prefix)
+	store, err := env.GetBlobStore(info.S3Bucket)
 	if err != nil {
 		logger.Critical(err)
 		return
 	}
-	data, err := bucket.Get(s3prefix + "jobdata.json")
+	data, err := store.Get(info.S3Prefix + "jobdata.json")
 	if err != nil {
 		logger.Critical(err)
 		return
@@ -630,58 +611,85 @@ func (w *Worker) Execute(jobname string) {
 		logger.Critical(err)
 		return
 	}
+	j.env = env
+	owner := newownerid()
+	ttl := j.LeaseTTL
+	if ttl <= 0 {
+		ttl = DefaultLeaseTTL
+	}
+
+	//Sample inputs first if the job wants globally sorted results
+	if j.SampleFraction > 0 {
+		err = w.splitpoints(co, store, j, jobname, owner, ttl, logger)
+		if err == errSampling || err == ErrLostLease || err == ErrJobFailed || err == ErrJobCancelled {
+			logger.Info("Not starting map stage", err)
+			return
+		}
+		if err != nil {
+			logger.Critical(err)
+			return
+		}
+	}
 
-	//Check if any map tasks need dooing...
+	//Check if any map tasks need dooing... or were abandoned by a dead worker
 	for i, input := range j.Inputs {
-		//Check if i exists... if not create it and we will process it.
-		_, err = cl.CreateDir(eprefix+"map/"+strconv.Itoa(i)+"/", 0)
-		if err == nil {
-			//Means we could create it, nobody else has it
-			logger.Info("Aquired lock for map task ", i)
+		err = checkjob(co, jobname)
+		if err != nil {
+			logger.Info("Not claiming map task", i, err)
+			return
+		}
+		ok, err := co.ClaimTask(jobname, StageMap, i, input, owner, ttl)
+		if err != nil {
+			logger.Critical(err)
+			return
+		}
+		if ok {
+			//Means we hold the lease, nobody else has it
+			logger.Info("Aquired lease for map task ", i, "as", owner)
 			//Update Status - we are obviously in map phase
-			_, err = cl.Update(eprefix+"status", strconv.Itoa(StatusMapStage), 0)
-			if err != nil {
-				logger.Critical(err)
-				return
-			}
-
-			//Create task status
-			_, err = cl.Create(eprefix+"map/"+strconv.Itoa(i)+"/"+"status", strconv.Itoa(StatusInitialized), 0)
-			if err != nil {
-				logger.Critical(err)
+			err = co.SetJobStatus(jobname, StatusMapStage)
+			if err == ErrJobFailed || err == ErrJobCancelled {
+				logger.Info("Not starting map task", i, err)
 				return
 			}
-
-			//Write input url
-			_, err = cl.Create(eprefix+"map/"+strconv.Itoa(i)+"/"+"input", input, 0)
 			if err != nil {
 				logger.Critical(err)
 				return
 			}
 			//Start map task
 			logger.Info("Starting map task", i)
+			hb := startheartbeat(co, j, jobname, StageMap, i, owner, ttl, logger)
+			started := time.Now()
 			outputs, err := w.Map(input, j, logger)
 			logger.Info(outputs, err)
-			if err != nil {
-				//TODO: Have retries for failures...
-				logger.Critical(err)
+			hberr := hb.stop()
+			if hberr == ErrJobCancelled {
+				logger.Info("Job was cancelled while running map task", i, "discarding outputs")
 				return
 			}
-			//Store outputs in etcd
-			_, err = cl.CreateDir(eprefix+"map/"+strconv.Itoa(i)+"/outputs/", 0)
+			if hberr != nil {
+				//Somebody else may be running it already, let them have it
+				logger.Critical("Lost lease for map task", i, "discarding outputs")
+				continue
+			}
 			if err != nil {
 				logger.Critical(err)
-				return
-			}
-			for idx, output := range outputs {
-				_, err = cl.Create(eprefix+"map/"+strconv.Itoa(i)+"/"+"outputs/"+strconv.Itoa(idx), output, 0)
+				err = failtask(co, j, jobname, StageMap, i, owner, started, err, logger)
+				if err == ErrJobFailed || err == ErrJobCancelled {
+					return
+				}
 				if err != nil {
 					logger.Critical(err)
 					return
 				}
+				continue
+			}
+			//Store outputs and mark as done
+			err = co.CompleteTask(jobname, StageMap, i, owner, outputs)
+			if err == ErrLostLease {
+				logger.Critical("Lost lease for map task", i, "discarding outputs")
+				continue
 			}
-			//Mark as done
-			_, err = cl.Update(eprefix+"map/"+strconv.Itoa(i)+"/"+"status", strconv.Itoa(StatusDone), 0)
 			if err != nil {
 				logger.Critical(err)
 				return
@@ -691,61 +699,58 @@ func (w *Worker) Execute(jobname string) {
 	//Check if map phase has finished....
 	reduceinputs := make(map[int][]string)
 	for i, _ := range j.Inputs {
-		resp, err = cl.Get(eprefix+"map/"+strconv.Itoa(i)+"/"+"status", false, false)
+		task, err := co.GetTask(jobname, StageMap, i)
 		if err != nil {
-			logger.Info("Map tasks not yet allocated fully.. shouldnt get to here usually")
+			logger.Critical(err)
 			return
-
 		}
-		status, err := strconv.Atoi(resp.Node.Value)
-		if err != nil {
-			logger.Critical(err)
+		if task == nil {
+			logger.Info("Map tasks not yet allocated fully.. shouldnt get to here usually")
 			return
 		}
-		if status != StatusDone {
+		if task.Status == StatusFail {
+			//Within the failure budget, otherwise the job would have failed
+			logger.Info("Skipping outputs of failed map task", i)
+			continue
+		}
+		if task.Status != StatusDone {
 			logger.Info("Map tasks not yet finished")
 			return
 		}
 		//Populate reduceinputs while we are at it...
-		resp, err = cl.Get(eprefix+"map/"+strconv.Itoa(i)+"/"+"outputs", false, true)
-		if err != nil {
-			logger.Critical(err)
-			return
-		}
-		for _, node := range resp.Node.Nodes {
-			splitted := strings.Split(node.Key, "/")
-			partitionid, err := strconv.Atoi(splitted[len(splitted)-1])
-			if err != nil {
-				logger.Critical(err)
-				return
-			}
-			reduceinputs[partitionid] = append(reduceinputs[partitionid], node.Value)
-			//log.Println(idx, node.Value)
+		for partitionid, output := range task.Outputs {
+			reduceinputs[partitionid] = append(reduceinputs[partitionid], output)
 		}
 	}
 	logger.Info("Map phase completed, now onto Reduce...")
 
 	//Update NumReduces
-	_, err = cl.Update(eprefix+"numreduces", strconv.Itoa(len(reduceinputs)), 0)
+	err = co.SetNumReduces(jobname, len(reduceinputs))
 	if err != nil {
 		logger.Critical(err)
 		return
 	}
 
 	for i, inputs := range reduceinputs {
-		_, err = cl.CreateDir(eprefix+"reduce/"+strconv.Itoa(i)+"/", 0)
-		if err == nil {
-			//Meaning we aquired lock for this phase...
-			logger.Info("Aquired lock for reduce task", i)
-			//Update Status - we are obviously in map phase
-			_, err = cl.Update(eprefix+"status", strconv.Itoa(StatusReduceStage), 0)
-			if err != nil {
-				logger.Critical(err)
+		err = checkjob(co, jobname)
+		if err != nil {
+			logger.Info("Not claiming reduce task", i, err)
+			return
+		}
+		ok, err := co.ClaimTask(jobname, StageReduce, i, "", owner, ttl)
+		if err != nil {
+			logger.Critical(err)
+			return
+		}
+		if ok {
+			//Meaning we aquired lease for this phase...
+			logger.Info("Aquired lease for reduce task", i, "as", owner)
+			//Update Status - we are obviously in reduce phase
+			err = co.SetJobStatus(jobname, StatusReduceStage)
+			if err == ErrJobFailed || err == ErrJobCancelled {
+				logger.Info("Not starting reduce task", i, err)
 				return
 			}
-
-			//Update Status
-			_, err = cl.Create(eprefix+"reduce/"+strconv.Itoa(i)+"/"+"status", strconv.Itoa(StatusInitialized), 0)
 			if err != nil {
 				logger.Critical(err)
 				return
@@ -753,20 +758,37 @@ func (w *Worker) Execute(jobname string) {
 
 			//Start reduce task
 			logger.Info("Starting reduce task", i)
+			hb := startheartbeat(co, j, jobname, StageReduce, i, owner, ttl, logger)
+			started := time.Now()
 			output, err := w.Reduce(inputs, i, j, logger)
 			logger.Info(output, err)
-			if err != nil {
-				logger.Critical(err)
+			hberr := hb.stop()
+			if hberr == ErrJobCancelled {
+				logger.Info("Job was cancelled while running reduce task", i, "discarding output")
 				return
 			}
-			//Write result to etcd
-			_, err = cl.Create(eprefix+"results/"+strconv.Itoa(i), output, 0)
+			if hberr != nil {
+				logger.Critical("Lost lease for reduce task", i, "discarding output")
+				continue
+			}
 			if err != nil {
 				logger.Critical(err)
-				return
+				err = failtask(co, j, jobname, StageReduce, i, owner, started, err, logger)
+				if err == ErrJobFailed || err == ErrJobCancelled {
+					return
+				}
+				if err != nil {
+					logger.Critical(err)
+					return
+				}
+				continue
+			}
+			//Write result and mark as done
+			err = co.CompleteTask(jobname, StageReduce, i, owner, map[int]string{i: output})
+			if err == ErrLostLease {
+				logger.Critical("Lost lease for reduce task", i, "discarding output")
+				continue
 			}
-			//Update Status as done
-			_, err = cl.Update(eprefix+"reduce/"+strconv.Itoa(i)+"/"+"status", strconv.Itoa(StatusDone), 0)
 			if err != nil {
 				logger.Critical(err)
 				return
@@ -775,17 +797,20 @@ func (w *Worker) Execute(jobname string) {
 	}
 	//Check if all reduces have finished....
 	for i, _ := range reduceinputs {
-		resp, err = cl.Get(eprefix+"reduce/"+strconv.Itoa(i)+"/"+"status", false, false)
+		task, err := co.GetTask(jobname, StageReduce, i)
 		if err != nil {
-			logger.Info("Reduce tasks not yet allocated fully.. shouldnt get to here usually")
+			logger.Critical(err)
 			return
 		}
-		status, err := strconv.Atoi(resp.Node.Value)
-		if err != nil {
-			logger.Critical(err)
+		if task == nil {
+			logger.Info("Reduce tasks not yet allocated fully.. shouldnt get to here usually")
 			return
 		}
-		if status != StatusDone {
+		if task.Status == StatusFail {
+			logger.Info("Reduce task", i, "failed, its partition will be missing from the results")
+			continue
+		}
+		if task.Status != StatusDone {
 			logger.Info("Reduce tasks not yet finished")
 			return
 		}
@@ -793,7 +818,11 @@ func (w *Worker) Execute(jobname string) {
 	//Got to here means everything is done....
 	logger.Info("All tasks are done...")
 	//Update status... doesnt matter if multiple workers invoke this...
-	_, err = cl.Update(eprefix+"status", strconv.Itoa(StatusDone), 0)
+	err = co.SetJobStatus(jobname, StatusDone)
+	if err == ErrJobFailed || err == ErrJobCancelled {
+		logger.Info("Not marking job done", err)
+		return
+	}
 	if err != nil {
 		logger.Critical(err)
 		return
@@ -807,10 +836,16 @@ type Environment struct {
 	ETCD_SERVERS          []string //comma separated contents of ETCD_SERVERS
 	AWS_REGION            string   //AWS region as detected by goamz ( https://godoc.org/github.com/mitchellh/goamz/aws#pkg-variables )
 	S3_BUCKET             string   //The default bucketname for new jobs
+	BLOBSTORE             string   //Storage backend for binaries, job data and outputs. "s3" (default) or "local"
+	LOCALSTORE_PATH       string   //Root directory used by the "local" BLOBSTORE, buckets are subdirectories of it
+	COORDINATOR           string   //Coordination backend. "etcd" (default, v2 API), "etcdv3" or "memory" which only works within a single process
 	LOGGLY_TOKEN          string   //Token for loggly, if available
 	LOGGLY_ACCOUNT        string   //Loggly account - used for retrieving logs only webapp needs it set
 	LOGGLY_USERNAME       string   //Loggly username - used for retrieving logs only webapp needs it set
 	LOGGLY_PASSWORD       string   //Loggly password - used for retrieving logs only webapp needs it set
+
+	//Used instead of the shared one by the "memory" COORDINATOR if set
+	memory *MemoryCoordinator
 }
 
 //Creates Environment data from reading environment variables
@@ -820,6 +855,9 @@ func NewEnvironment() *Environment {
 		AWS_SECRET_ACCESS_KEY: os.Getenv("AWS_SECRET_ACCESS_KEY"),
 		AWS_REGION:            os.Getenv("AWS_REGION"),
 		S3_BUCKET:             os.Getenv("S3_BUCKET"),
+		BLOBSTORE:             os.Getenv("BLOBSTORE"),
+		LOCALSTORE_PATH:       os.Getenv("LOCALSTORE_PATH"),
+		COORDINATOR:           os.Getenv("COORDINATOR"),
 		LOGGLY_TOKEN:          os.Getenv("LOGGLY_TOKEN"),
 		LOGGLY_ACCOUNT:        os.Getenv("LOGGLY_ACCOUNT"),
 		LOGGLY_USERNAME:       os.Getenv("LOGGLY_USERNAME"),
@@ -867,11 +905,48 @@ func (env *Environment) GetS3Bucket(bucketname string) (*s3.Bucket, error) {
 	return s.Bucket(bucketname), nil
 }
 
+//Returns the BlobStore for the given bucket, as selected by BLOBSTORE
+func (env *Environment) GetBlobStore(bucketname string) (BlobStore, error) {
+	switch env.BLOBSTORE {
+	case "", "s3":
+		bucket, err := env.GetS3Bucket(bucketname)
+		if err != nil {
+			return nil, err
+		}
+		return NewS3BlobStore(bucket), nil
+	case "local":
+		if env.LOCALSTORE_PATH == "" {
+			return nil, errors.New("LOCALSTORE_PATH must be set for the local BLOBSTORE")
+		}
+		return NewLocalBlobStore(env.LOCALSTORE_PATH, bucketname), nil
+	}
+	return nil, errors.New("Unknown BLOBSTORE '" + env.BLOBSTORE + "'")
+}
+
 //Returns etcd client
 func (env *Environment) GetEtcdClient() *etcd.Client {
 	return etcd.NewClient(env.ETCD_SERVERS)
 }
 
+//Shared by every Environment using the "memory" COORDINATOR
+var memorycoordinator = NewMemoryCoordinator()
+
+//Returns the Coordinator selected by COORDINATOR
+func (env *Environment) GetCoordinator() (Coordinator, error) {
+	switch env.COORDINATOR {
+	case "", "etcd":
+		return NewEtcdCoordinator(env.ETCD_SERVERS), nil
+	case "etcdv3":
+		return NewEtcdV3Coordinator(env.ETCD_SERVERS)
+	case "memory":
+		if env.memory != nil {
+			return env.memory, nil
+		}
+		return memorycoordinator, nil
+	}
+	return nil, errors.New("Unknown COORDINATOR '" + env.COORDINATOR + "'")
+}
+
 //Returns logging implementation
 func (env *Environment) GetLogger(tags []string) Logger {
 	if env.LOGGLY_TOKEN != "" {
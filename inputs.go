@@ -0,0 +1,135 @@
+package gomr
+
+import (
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+//Whether s contains glob metacharacters
+func hasglob(s string) bool {
+	return strings.ContainsAny(s, "*?[")
+}
+
+//Expand input specs into individual map inputs, Deploy does this for Job.Inputs.
+//
+//	s3://bucket/logs/2016-10-*/*.gz - objects matching the pattern, as s3://bucket/key
+//	s3://bucket/logs/ - every object under the prefix
+//	/data/logs/*.gz - local files matching the pattern
+//	/data/logs - every file in the local directory and below
+//
+//Patterns follow path.Match, so * doesn't match /. Local inputs only make sense if all
+//workers see the same filesystem. Local patterns are only expanded if they name an existing
+//directory or match files, so inputs only Map understands can contain wildcards. Anything
+//else, e.g. http URLs, is passed through as is
+func (env *Environment) ExpandInputs(inputs []string) ([]string, error) {
+	expanded := []string{}
+	for _, input := range inputs {
+		var matches []string
+		var err error
+		switch {
+		case strings.HasPrefix(input, "s3://"):
+			matches, err = env.expands3(input)
+		case strings.Contains(input, "://"):
+			matches = []string{input}
+		default:
+			matches, err = expandlocal(input)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(matches) == 0 {
+			return nil, errors.New("Input '" + input + "' matches nothing")
+		}
+		expanded = append(expanded, matches...)
+	}
+	return expanded, nil
+}
+
+//Expand s3://bucket/pattern using the BlobStore of the bucket
+func (env *Environment) expands3(input string) ([]string, error) {
+	bucket, pattern, err := parses3url(input)
+	if err != nil {
+		return nil, err
+	}
+	if !hasglob(pattern) && !strings.HasSuffix(pattern, "/") {
+		//A single object
+		return []string{input}, nil
+	}
+	//Only list below the part of the pattern without wildcards
+	prefix := pattern
+	if idx := strings.IndexAny(pattern, "*?["); idx >= 0 {
+		prefix = pattern[:idx]
+	}
+	store, err := env.GetBlobStore(bucket)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := store.List(prefix)
+	if err != nil {
+		return nil, err
+	}
+	matches := []string{}
+	for _, key := range keys {
+		ok := strings.HasSuffix(pattern, "/")
+		if !ok {
+			ok, err = path.Match(pattern, key)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if ok {
+			matches = append(matches, "s3://"+bucket+"/"+key)
+		}
+	}
+	sort.Strings(matches)
+	return matches, nil
+}
+
+//Expand a local glob or directory, other paths are passed through
+func expandlocal(input string) ([]string, error) {
+	if hasglob(input) {
+		matches, err := filepath.Glob(input)
+		if err == filepath.ErrBadPattern {
+			//Not meant as a pattern
+			return []string{input}, nil
+		}
+		if err != nil || len(matches) > 0 {
+			return matches, err
+		}
+		//Patterns below an existing directory that match nothing are likely mistakes
+		prefix := input[:strings.IndexAny(input, "*?[")]
+		if strings.ContainsRune(prefix, filepath.Separator) {
+			info, err := os.Stat(filepath.Dir(prefix))
+			if err == nil && info.IsDir() {
+				return nil, nil
+			}
+		}
+		return []string{input}, nil
+	}
+	info, err := os.Stat(input)
+	if err != nil || !info.IsDir() {
+		//Not ours to judge, Map may know what to do with it
+		return []string{input}, nil
+	}
+	matches := []string{}
+	err = filepath.Walk(input, func(fname string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(info.Name(), ".") && fname != input {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.Mode().IsRegular() {
+			matches = append(matches, fname)
+		}
+		return nil
+	})
+	return matches, err
+}
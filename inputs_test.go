@@ -0,0 +1,57 @@
+package gomr
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestExpandLocalInputs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gomr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"a.gz", "b.gz", "c.txt", "sub/d.gz", "sub/.hidden"} {
+		fname := filepath.Join(dir, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(fname), 0755)
+		err = ioutil.WriteFile(fname, []byte(name), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	p := func(name string) string {
+		return filepath.Join(dir, filepath.FromSlash(name))
+	}
+	tests := []struct {
+		input    string
+		expanded []string //nil if expanding fails
+	}{
+		{p("*.gz"), []string{p("a.gz"), p("b.gz")}},
+		{p("*/*.gz"), []string{p("sub/d.gz")}},
+		{p("sub"), []string{p("sub/d.gz")}},
+		{p("c.txt"), []string{p("c.txt")}},
+		{p("missing"), []string{p("missing")}},
+		{p("*.csv"), nil},
+		{p("nodir/*.gz"), []string{p("nodir/*.gz")}},
+		{"query?id=5", []string{"query?id=5"}},
+		{"SELECT * FROM logs", []string{"SELECT * FROM logs"}},
+		{"[unclosed", []string{"[unclosed"}},
+		{"https://example.com/*.gz", []string{"https://example.com/*.gz"}},
+	}
+	env := &Environment{}
+	for _, test := range tests {
+		expanded, err := env.ExpandInputs([]string{test.input})
+		if test.expanded == nil {
+			if err == nil {
+				t.Errorf("%s: expected an error, got %v", test.input, expanded)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(expanded, test.expanded) {
+			t.Errorf("%s: got %v %v, want %v", test.input, expanded, err, test.expanded)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package gomr
+
+import (
+	"fmt"
+	"github.com/satori/go.uuid"
+	"os"
+	"time"
+)
+
+//How long a claimed task stays leased without heartbeats, unless the Job says otherwise
+const DefaultLeaseTTL = 30 * time.Second
+
+//Unique ID identifying this process as the owner of the tasks it claims
+func newownerid() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	//Binaries started by a worker daemon are owned by it
+	if worker := os.Getenv(workerenv); worker != "" {
+		return fmt.Sprintf("%s/%d-%s", worker, os.Getpid(), uuid.NewV4().String()[:8])
+	}
+	return fmt.Sprintf("%s-%d-%s", hostname, os.Getpid(), uuid.NewV4().String()[:8])
+}
+
+//Renews a task lease in the background while the task runs
+type heartbeat struct {
+	stopch chan struct{}
+	done   chan error
+}
+
+//Starts renewing the lease every third of ttl. Every renewal also checks whether the job
+//got cancelled, and if so flags j so Map and Reduce can bail out early
+func startheartbeat(co Coordinator, j *Job, jobname, stage string, id int, owner string, ttl time.Duration, logger Logger) *heartbeat {
+	hb := &heartbeat{make(chan struct{}), make(chan error, 1)}
+	go func() {
+		ticker := time.NewTicker(ttl / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-hb.stopch:
+				hb.done <- nil
+				return
+			case <-ticker.C:
+				err := co.RenewTask(jobname, stage, id, owner, ttl)
+				if err == ErrLostLease {
+					hb.done <- err
+					return
+				}
+				if err != nil {
+					//Might be a blip, the lease is still good until ttl runs out
+					logger.Info("Failed to renew lease for", stage, "task", id, err)
+				}
+				if checkjob(co, jobname) == ErrJobCancelled {
+					j.cancel()
+					hb.done <- ErrJobCancelled
+					return
+				}
+			}
+		}
+	}()
+	return hb
+}
+
+//Stops renewing, returns ErrLostLease if the lease was lost or ErrJobCancelled if the job got cancelled while running
+func (hb *heartbeat) stop() error {
+	select {
+	case err := <-hb.done:
+		return err
+	default:
+	}
+	close(hb.stopch)
+	return <-hb.done
+}
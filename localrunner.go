@@ -0,0 +1,152 @@
+package gomr
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+//Runs a job inside the current process, for developing and testing Map and Reduce functions
+//without etcd, S3 or deployed binaries.
+//
+//Coordination happens in memory and blobs are stored in a local directory, otherwise the job
+//goes through the same code paths as on a cluster.
+//
+//	results, err := (&gomr.LocalRunner{Worker: w.Worker()}).Run(job)
+type LocalRunner struct {
+	Worker      *Worker
+	Parallelism int    //Optional - How many workers run concurrently. Defaults to 1
+	Dir         string //Optional - Where blobs are stored. By default a temporary directory is used and removed afterwards
+}
+
+//How long to wait between passes while tasks wait for a retry
+const localrunnerpoll = 50 * time.Millisecond
+
+//Runs the job until it is done and returns the uncompressed contents of its results in
+//partition order. Inputs must make sense to the Worker's Map as they would on a cluster.
+//Gives up once a pass of the workers doesn't change anything, e.g. because they can't read the job
+func (r *LocalRunner) Run(j *Job) ([][]byte, error) {
+	dir := r.Dir
+	if dir == "" {
+		tmp, err := ioutil.TempDir("", "gomr")
+		if err != nil {
+			return nil, err
+		}
+		defer os.RemoveAll(tmp)
+		dir = tmp
+	}
+	env := &Environment{
+		BLOBSTORE:       "local",
+		LOCALSTORE_PATH: dir,
+		COORDINATOR:     "memory",
+		S3_BUCKET:       "local",
+		memory:          NewMemoryCoordinator(),
+	}
+	if j.S3Bucket == "" {
+		j.S3Bucket = env.S3_BUCKET
+	}
+	store, err := env.GetBlobStore(j.S3Bucket)
+	if err != nil {
+		return nil, err
+	}
+	//There is no binary, the Worker runs in this process
+	err = j.register(env, store, "")
+	if err != nil {
+		return nil, err
+	}
+	parallelism := r.Parallelism
+	if parallelism < 1 {
+		parallelism = 1
+	}
+	state, _, err := localstate(env.memory, j.Name)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		var wg sync.WaitGroup
+		for i := 0; i < parallelism; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				r.Worker.execute(env, j.Name)
+			}()
+		}
+		wg.Wait()
+		err = j.updatestatus(env.memory)
+		if err != nil {
+			return nil, err
+		}
+		switch j.Status {
+		case StatusDone:
+			return readresults(store, j.Results)
+		case StatusFail:
+			return nil, errors.New("Job failed at task " + j.FailedTask + ": " + j.FailReason)
+		case StatusCancelled:
+			return nil, ErrJobCancelled
+		}
+		previous := state
+		var backoff bool
+		state, backoff, err = localstate(env.memory, j.Name)
+		if err != nil {
+			return nil, err
+		}
+		if state == previous && !backoff {
+			return nil, errors.New("Job " + j.Name + " makes no progress, see the log for errors")
+		}
+		//Tasks are waiting for their retry
+		time.Sleep(localrunnerpoll)
+	}
+}
+
+//Summary of the job and its tasks, which changes whenever workers get anywhere. Also
+//returns whether tasks wait for a retry, passes don't change anything while they do
+func localstate(co Coordinator, jobname string) (string, bool, error) {
+	info, err := co.GetJob(jobname)
+	if err != nil {
+		return "", false, err
+	}
+	state := fmt.Sprint(info.Status, info.NumReduces)
+	backoff := false
+	now := time.Now()
+	for _, stage := range []string{StageSample, StageMap, StageReduce} {
+		tasks, err := co.ListTasks(jobname, stage)
+		if err != nil {
+			return "", false, err
+		}
+		for _, task := range tasks {
+			state += fmt.Sprint(" ", stage, task.ID, task.Status, task.Owner, len(task.Attempts))
+			if task.Status == StatusInitialized && task.RetryAfter.After(now) {
+				backoff = true
+			}
+		}
+	}
+	return state, backoff, nil
+}
+
+//Download and uncompress results
+func readresults(store BlobStore, results []string) ([][]byte, error) {
+	contents := [][]byte{}
+	for _, result := range results {
+		rd, err := store.GetReader(result)
+		if err != nil {
+			return nil, err
+		}
+		gzrd, err := gzip.NewReader(rd)
+		if err != nil {
+			rd.Close()
+			return nil, err
+		}
+		b, err := ioutil.ReadAll(gzrd)
+		gzrd.Close()
+		rd.Close()
+		if err != nil {
+			return nil, err
+		}
+		contents = append(contents, b)
+	}
+	return contents, nil
+}
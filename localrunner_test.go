@@ -0,0 +1,149 @@
+package gomr
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func wordcountmap(rec *Record, emit EmitFunc, job *Job, logger Logger) error {
+	for _, word := range strings.Fields(rec.Data) {
+		emit(word, "1")
+	}
+	return nil
+}
+
+func wordcountreduce(word string, values *Values, emit EmitFunc, job *Job, logger Logger) error {
+	return sumcombine(word, values, emit)
+}
+
+//Write files with the given contents to a temporary directory
+func testinputs(t *testing.T, contents ...string) (string, []string) {
+	dir, err := ioutil.TempDir("", "gomr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	inputs := []string{}
+	for i, content := range contents {
+		fname := filepath.Join(dir, "input"+strconv.Itoa(i))
+		err = ioutil.WriteFile(fname, []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		inputs = append(inputs, fname)
+	}
+	return dir, inputs
+}
+
+//Run a job with a timeout, so a runner that never gives up fails the test
+func runlocal(t *testing.T, r *LocalRunner, j *Job) ([][]byte, error) {
+	type result struct {
+		results [][]byte
+		err     error
+	}
+	done := make(chan result, 1)
+	go func() {
+		results, err := r.Run(j)
+		done <- result{results, err}
+	}()
+	select {
+	case res := <-done:
+		return res.results, res.err
+	case <-time.After(30 * time.Second):
+		t.Fatal("LocalRunner didn't finish")
+	}
+	return nil, nil
+}
+
+func TestLocalRunnerWordCount(t *testing.T) {
+	dir, inputs := testinputs(t,
+		"the quick brown fox\njumps over the lazy dog\n",
+		"the dog barks\nthe fox runs",
+		"",
+	)
+	defer os.RemoveAll(dir)
+	want := []string{"barks\t1", "brown\t1", "dog\t2", "fox\t2", "jumps\t1", "lazy\t1", "over\t1", "quick\t1", "runs\t1", "the\t4"}
+	tests := []struct {
+		name string
+		job  *Job
+	}{
+		{"one map per input", &Job{Inputs: inputs, Partitions: 3}},
+		{"split inputs", &Job{Inputs: inputs, Partitions: 2, SplitSize: 10}},
+		{"sorted", &Job{Inputs: inputs, Partitions: 2, SampleFraction: 1}},
+	}
+	for _, test := range tests {
+		w := &EmitWorker{MapRecord: wordcountmap, Reduce: wordcountreduce, Combine: wordcountreduce}
+		results, err := runlocal(t, &LocalRunner{Worker: w.Worker(), Parallelism: 3}, test.job)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		lines := []string{}
+		for _, result := range results {
+			lines = append(lines, strings.Split(strings.TrimSuffix(string(result), "\n"), "\n")...)
+		}
+		if test.job.SampleFraction == 0 {
+			sort.Strings(lines)
+		}
+		if !reflect.DeepEqual(lines, want) {
+			t.Errorf("%s: got %q, want %q", test.name, lines, want)
+		}
+	}
+}
+
+func TestLocalRunnerRetry(t *testing.T) {
+	dir, inputs := testinputs(t, "a b a\n")
+	defer os.RemoveAll(dir)
+	failures := 0
+	w := &EmitWorker{
+		MapRecord: func(rec *Record, emit EmitFunc, job *Job, logger Logger) error {
+			if failures < 2 {
+				failures++
+				return errors.New("flaky")
+			}
+			return wordcountmap(rec, emit, job, logger)
+		},
+		Reduce: wordcountreduce,
+	}
+	job := &Job{Inputs: inputs, Partitions: 1, Retry: &RetryPolicy{MaxAttempts: 3, Backoff: 100 * time.Millisecond}}
+	results, err := runlocal(t, &LocalRunner{Worker: w.Worker()}, job)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || string(results[0]) != "a\t2\nb\t1\n" {
+		t.Errorf("Got %q", results)
+	}
+}
+
+func TestLocalRunnerNoProgress(t *testing.T) {
+	dir, inputs := testinputs(t, "a\n")
+	defer os.RemoveAll(dir)
+	store := filepath.Join(dir, "store")
+	w := &Worker{
+		//Break the job for every later pass, then fail the task so it gets retried
+		Map: func(input string, job *Job, logger Logger) (map[int]string, error) {
+			filepath.Walk(store, func(fname string, info os.FileInfo, err error) error {
+				if err == nil && info.Name() == "jobdata.json" {
+					os.Remove(fname)
+				}
+				return nil
+			})
+			return nil, errors.New("broken")
+		},
+		Reduce: func(inputs []string, partition int, job *Job, logger Logger) (string, error) {
+			return "", nil
+		},
+	}
+	job := &Job{Inputs: inputs, Partitions: 1, Retry: &RetryPolicy{MaxAttempts: 3}}
+	_, err := runlocal(t, &LocalRunner{Worker: w, Dir: store}, job)
+	if err == nil || !strings.Contains(err.Error(), "no progress") {
+		t.Errorf("Expected the runner to give up, got %v", err)
+	}
+}
@@ -0,0 +1,197 @@
+package gomr
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+//Stores blobs as files under a local or NFS mounted directory.
+//
+//Each bucket is a subdirectory of root and keys map to files below it, so the
+//layout is the same as on S3 i.e. <root>/<bucket>/bin/<sha256>, <root>/<bucket>/<prefix>/<job>/maps/...
+//Files are written to a temporary name and renamed into place so readers on other
+//machines never see a partially written blob.
+//
+//A leading / of keys is ignored, so /<job>/jobdata.json and <job>/jobdata.json are the same file.
+type LocalBlobStore struct {
+	dir string
+}
+
+func NewLocalBlobStore(root, bucketname string) *LocalBlobStore {
+	return &LocalBlobStore{filepath.Join(root, bucketname)}
+}
+
+//Converts key into a filename, refusing keys that would escape the bucket directory
+func (b *LocalBlobStore) filename(key string) (string, error) {
+	//Job data lives under /<job>/ unless Job.S3Prefix is set
+	key = strings.TrimPrefix(key, "/")
+	if key == "" || path.Clean(key) != key || strings.HasPrefix(key, "/") || strings.HasPrefix(key, "../") {
+		return "", errors.New("Invalid key '" + key + "'")
+	}
+	return filepath.Join(b.dir, filepath.FromSlash(key)), nil
+}
+
+func (b *LocalBlobStore) Put(key string, r io.Reader, length int64, contenttype string) error {
+	fname, err := b.filename(key)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(fname), 0775)
+	if err != nil {
+		return err
+	}
+	//Temporary files are hidden so List skips them
+	f, err := ioutil.TempFile(filepath.Dir(fname), "."+filepath.Base(fname)+".tmp")
+	if err != nil {
+		return err
+	}
+	n, err := io.Copy(f, r)
+	if err == nil && n != length {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	err = f.Close()
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), fname)
+}
+
+func (b *LocalBlobStore) Get(key string) ([]byte, error) {
+	fname, err := b.filename(key)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadFile(fname)
+}
+
+func (b *LocalBlobStore) GetReader(key string) (io.ReadCloser, error) {
+	fname, err := b.filename(key)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(fname)
+}
+
+func (b *LocalBlobStore) GetRange(key string, start, end int64) (io.ReadCloser, error) {
+	fname, err := b.filename(key)
+	if err != nil {
+		return nil, err
+	}
+	return openfilerange(fname, start, end)
+}
+
+func (b *LocalBlobStore) Size(key string) (int64, error) {
+	fname, err := b.filename(key)
+	if err != nil {
+		return 0, err
+	}
+	info, err := os.Stat(fname)
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+//Reads part of a file
+type filerange struct {
+	io.Reader
+	f *os.File
+}
+
+func (r *filerange) Close() error {
+	return r.f.Close()
+}
+
+//Open bytes start up to end (exclusive) of fname, end -1 reads to the end
+func openfilerange(fname string, start, end int64) (io.ReadCloser, error) {
+	f, err := os.Open(fname)
+	if err != nil {
+		return nil, err
+	}
+	_, err = f.Seek(start, 0)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if end < 0 {
+		return f, nil
+	}
+	if end < start {
+		end = start
+	}
+	return &filerange{io.LimitReader(f, end-start), f}, nil
+}
+
+func (b *LocalBlobStore) Exists(key string) (bool, error) {
+	fname, err := b.filename(key)
+	if err != nil {
+		return false, err
+	}
+	_, err = os.Stat(fname)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func (b *LocalBlobStore) List(prefix string) ([]string, error) {
+	keys := []string{}
+	//Keys are listed the way they were asked for
+	lead := ""
+	if strings.HasPrefix(prefix, "/") {
+		lead = "/"
+		prefix = prefix[1:]
+	}
+	//Only walk the deepest directory the prefix names
+	start := b.dir
+	if idx := strings.LastIndex(prefix, "/"); idx >= 0 {
+		start = filepath.Join(b.dir, filepath.FromSlash(prefix[:idx]))
+	}
+	err := filepath.Walk(start, func(fname string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() || strings.HasPrefix(info.Name(), ".") {
+			return nil
+		}
+		rel, err := filepath.Rel(b.dir, fname)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, lead+key)
+		}
+		return nil
+	})
+	return keys, err
+}
+
+func (b *LocalBlobStore) Delete(key string) error {
+	fname, err := b.filename(key)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(fname)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
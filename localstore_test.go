@@ -0,0 +1,80 @@
+package gomr
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLocalBlobStoreKeys(t *testing.T) {
+	store := NewLocalBlobStore("/root", "bucket")
+	tests := []struct {
+		key   string
+		fname string
+	}{
+		{"bin/abc", "/root/bucket/bin/abc"},
+		{"/job/jobdata.json", "/root/bucket/job/jobdata.json"},
+		{"prefix/job/maps/0-x", "/root/bucket/prefix/job/maps/0-x"},
+		{"", ""},
+		{"/", ""},
+		{"//job", ""},
+		{"../other/key", ""},
+		{"job/../../key", ""},
+		{"job//key", ""},
+	}
+	for _, test := range tests {
+		fname, err := store.filename(test.key)
+		if test.fname == "" {
+			if err == nil {
+				t.Errorf("%q: expected an error, got %s", test.key, fname)
+			}
+			continue
+		}
+		if err != nil || fname != test.fname {
+			t.Errorf("%q: got %s %v, want %s", test.key, fname, err, test.fname)
+		}
+	}
+}
+
+func TestLocalBlobStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gomr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store := NewLocalBlobStore(dir, "bucket")
+	for _, key := range []string{"/job/jobdata.json", "/job/maps/0-a", "/jobx/jobdata.json", "bin/abc"} {
+		err = store.Put(key, strings.NewReader(key), int64(len(key)), "text/plain")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, err := store.Get("job/jobdata.json")
+	if err != nil || string(data) != "/job/jobdata.json" {
+		t.Fatalf("Get: %q %v", data, err)
+	}
+	keys, err := store.List("/job/")
+	if err != nil || !reflect.DeepEqual(keys, []string{"/job/jobdata.json", "/job/maps/0-a"}) {
+		t.Fatalf("List: %v %v", keys, err)
+	}
+	for _, key := range keys {
+		err = store.Delete(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	keys, err = store.List("bin/")
+	if err != nil || !reflect.DeepEqual(keys, []string{"bin/abc"}) {
+		t.Fatalf("List: %v %v", keys, err)
+	}
+	ok, err := store.Exists("/job/jobdata.json")
+	if err != nil || ok {
+		t.Fatalf("Exists after delete: %v %v", ok, err)
+	}
+	ok, err = store.Exists("/jobx/jobdata.json")
+	if err != nil || !ok {
+		t.Fatalf("Exists: %v %v", ok, err)
+	}
+}
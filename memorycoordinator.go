@@ -0,0 +1,383 @@
+package gomr
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+//Coordinator keeping all state in memory of the current process.
+//
+//Only useful when every worker runs inside one process, e.g. tests and local runs.
+//It follows the same locking semantics as the etcd implementation.
+type MemoryCoordinator struct {
+	mu       sync.Mutex
+	jobs     map[string]*memoryjob
+	watchers map[chan struct{}]bool
+	workers  map[string]*memoryworker
+}
+
+type memoryjob struct {
+	info    JobInfo
+	tasks   map[string]map[int]*memorytask //stage -> id -> task
+	results map[int]string
+}
+
+type memoryworker struct {
+	info    WorkerInfo
+	expires time.Time
+}
+
+type memorytask struct {
+	TaskInfo
+	expires time.Time //End of the current lease
+}
+
+func NewMemoryCoordinator() *MemoryCoordinator {
+	return &MemoryCoordinator{jobs: make(map[string]*memoryjob)}
+}
+
+//Copy task so callers can't modify our state
+func copytask(task *memorytask) *TaskInfo {
+	t := task.TaskInfo
+	t.Outputs = make(map[int]string)
+	for k, v := range task.Outputs {
+		t.Outputs[k] = v
+	}
+	t.Attempts = append([]*TaskAttempt{}, task.Attempts...)
+	t.Leased = task.expires.After(time.Now())
+	return &t
+}
+
+//Returns the task if owner holds its lease
+func (job *memoryjob) ownedtask(stage string, id int, owner string) (*memorytask, error) {
+	task, ok := job.tasks[stage][id]
+	if !ok || task.Owner != owner || !task.expires.After(time.Now()) {
+		return nil, ErrLostLease
+	}
+	return task, nil
+}
+
+func (c *MemoryCoordinator) getjob(jobname string) (*memoryjob, error) {
+	job, ok := c.jobs[jobname]
+	if !ok {
+		return nil, errors.New("Job '" + jobname + "' not found")
+	}
+	return job, nil
+}
+
+func (c *MemoryCoordinator) CreateJob(info *JobInfo) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.jobs[info.Name]; ok {
+		return errors.New("Job '" + info.Name + "' already exists")
+	}
+	c.jobs[info.Name] = &memoryjob{
+		info: *info,
+		tasks: map[string]map[int]*memorytask{
+			StageMap:    make(map[int]*memorytask),
+			StageReduce: make(map[int]*memorytask),
+			StageSample: make(map[int]*memorytask),
+		},
+		results: make(map[int]string),
+	}
+	c.notify()
+	return nil
+}
+
+func (c *MemoryCoordinator) GetJob(jobname string) (*JobInfo, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	job, err := c.getjob(jobname)
+	if err != nil {
+		return nil, err
+	}
+	info := job.info
+	return &info, nil
+}
+
+func (c *MemoryCoordinator) ListJobs() ([]string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	jobs := []string{}
+	for name, _ := range c.jobs {
+		jobs = append(jobs, name)
+	}
+	sort.Strings(jobs)
+	return jobs, nil
+}
+
+func (c *MemoryCoordinator) DeleteJob(jobname string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.jobs, jobname)
+	return nil
+}
+
+func (c *MemoryCoordinator) SetJobStatus(jobname string, status int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	job, err := c.getjob(jobname)
+	if err != nil {
+		return err
+	}
+	switch job.info.Status {
+	case StatusFail:
+		return ErrJobFailed
+	case StatusCancelled:
+		return ErrJobCancelled
+	}
+	job.info.Status = status
+	return nil
+}
+
+func (c *MemoryCoordinator) CancelJob(jobname string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	job, err := c.getjob(jobname)
+	if err != nil {
+		return err
+	}
+	if job.info.Status == StatusDone || job.info.Status == StatusFail {
+		return errors.New("Job '" + jobname + "' already finished")
+	}
+	job.info.Status = StatusCancelled
+	return nil
+}
+
+func (c *MemoryCoordinator) FailJob(jobname, reason, task string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	job, err := c.getjob(jobname)
+	if err != nil {
+		return err
+	}
+	switch job.info.Status {
+	case StatusFail:
+		return ErrJobFailed
+	case StatusCancelled:
+		return ErrJobCancelled
+	case StatusDone:
+		return errors.New("Job '" + jobname + "' already finished")
+	}
+	job.info.Status = StatusFail
+	job.info.FailReason = reason
+	job.info.FailedTask = task
+	return nil
+}
+
+func (c *MemoryCoordinator) SetNumReduces(jobname string, n int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	job, err := c.getjob(jobname)
+	if err != nil {
+		return err
+	}
+	job.info.NumReduces = n
+	if n > 0 {
+		c.notify()
+	}
+	return nil
+}
+
+func (c *MemoryCoordinator) ClaimTask(jobname, stage string, id int, input, owner string, ttl time.Duration) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	job, err := c.getjob(jobname)
+	if err != nil {
+		return false, err
+	}
+	task, ok := job.tasks[stage][id]
+	if ok && (task.Status != StatusInitialized || task.expires.After(time.Now()) || task.RetryAfter.After(time.Now())) {
+		return false, nil
+	}
+	if !ok {
+		task = &memorytask{TaskInfo: TaskInfo{ID: id, Outputs: make(map[int]string)}}
+		job.tasks[stage][id] = task
+	}
+	task.Status = StatusInitialized
+	task.Owner = owner
+	task.expires = time.Now().Add(ttl)
+	if stage == StageMap {
+		task.Input = input
+	}
+	return true, nil
+}
+
+func (c *MemoryCoordinator) RenewTask(jobname, stage string, id int, owner string, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	job, err := c.getjob(jobname)
+	if err != nil {
+		return err
+	}
+	task, err := job.ownedtask(stage, id, owner)
+	if err != nil {
+		return err
+	}
+	task.expires = time.Now().Add(ttl)
+	return nil
+}
+
+func (c *MemoryCoordinator) CompleteTask(jobname, stage string, id int, owner string, outputs map[int]string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	job, err := c.getjob(jobname)
+	if err != nil {
+		return err
+	}
+	task, err := job.ownedtask(stage, id, owner)
+	if err != nil {
+		return err
+	}
+	for idx, output := range outputs {
+		if stage == StageReduce {
+			job.results[idx] = output
+		} else {
+			task.Outputs[idx] = output
+		}
+	}
+	task.Status = StatusDone
+	task.expires = time.Time{}
+	c.notify()
+	return nil
+}
+
+func (c *MemoryCoordinator) ReleaseTask(jobname, stage string, id int, owner string, attempt *TaskAttempt, retryafter time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	job, err := c.getjob(jobname)
+	if err != nil {
+		return err
+	}
+	task, err := job.ownedtask(stage, id, owner)
+	if err != nil {
+		return err
+	}
+	a := *attempt
+	task.Attempts = append(task.Attempts, &a)
+	task.RetryAfter = retryafter
+	task.expires = time.Time{}
+	c.notify()
+	return nil
+}
+
+func (c *MemoryCoordinator) FailTask(jobname, stage string, id int, owner string, attempt *TaskAttempt) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	job, err := c.getjob(jobname)
+	if err != nil {
+		return err
+	}
+	task, err := job.ownedtask(stage, id, owner)
+	if err != nil {
+		return err
+	}
+	a := *attempt
+	task.Attempts = append(task.Attempts, &a)
+	task.Status = StatusFail
+	task.expires = time.Time{}
+	c.notify()
+	return nil
+}
+
+func (c *MemoryCoordinator) GetTask(jobname, stage string, id int) (*TaskInfo, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	job, err := c.getjob(jobname)
+	if err != nil {
+		return nil, err
+	}
+	task, ok := job.tasks[stage][id]
+	if !ok {
+		return nil, nil
+	}
+	return copytask(task), nil
+}
+
+func (c *MemoryCoordinator) ListTasks(jobname, stage string) ([]*TaskInfo, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	tasks := []*TaskInfo{}
+	job, err := c.getjob(jobname)
+	if err != nil {
+		return tasks, err
+	}
+	for _, task := range job.tasks[stage] {
+		tasks = append(tasks, copytask(task))
+	}
+	sort.Sort(tasksbyid(tasks))
+	return tasks, nil
+}
+
+func (c *MemoryCoordinator) Results(jobname string) (map[int]string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	results := make(map[int]string)
+	job, err := c.getjob(jobname)
+	if err != nil {
+		return results, err
+	}
+	for k, v := range job.results {
+		results[k] = v
+	}
+	return results, nil
+}
+
+func (c *MemoryCoordinator) RegisterWorker(info *WorkerInfo, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.workers == nil {
+		c.workers = make(map[string]*memoryworker)
+	}
+	c.workers[info.ID] = &memoryworker{*info, time.Now().Add(ttl)}
+	return nil
+}
+
+func (c *MemoryCoordinator) ListWorkers() ([]*WorkerInfo, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	workers := []*WorkerInfo{}
+	for id, w := range c.workers {
+		if now.After(w.expires) {
+			delete(c.workers, id)
+			continue
+		}
+		info := w.info
+		workers = append(workers, &info)
+	}
+	sort.Sort(workersbyid(workers))
+	return workers, nil
+}
+
+//Signal watchers of a change that may make tasks claimable, see wakesworkers. c.mu must be held
+func (c *MemoryCoordinator) notify() {
+	for ch := range c.watchers {
+		signal(ch)
+	}
+}
+
+//Signals on every change that may make tasks claimable. Expiring leases aren't noticed
+func (c *MemoryCoordinator) Watch(stop <-chan struct{}) (<-chan struct{}, error) {
+	notify := make(chan struct{}, 1)
+	c.mu.Lock()
+	if c.watchers == nil {
+		c.watchers = make(map[chan struct{}]bool)
+	}
+	c.watchers[notify] = true
+	c.mu.Unlock()
+	go func() {
+		<-stop
+		c.mu.Lock()
+		delete(c.watchers, notify)
+		close(notify)
+		c.mu.Unlock()
+	}()
+	return notify, nil
+}
+
+func (c *MemoryCoordinator) Close() {
+	//Do nothing. State must outlive individual users
+}
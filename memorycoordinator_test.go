@@ -0,0 +1,283 @@
+package gomr
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+const testttl = 50 * time.Millisecond
+
+func newtestcoordinator(t *testing.T) *MemoryCoordinator {
+	c := NewMemoryCoordinator()
+	err := c.CreateJob(&JobInfo{Name: "job", NumMaps: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestMemoryCoordinatorLeases(t *testing.T) {
+	attempt := &TaskAttempt{Owner: "a", Error: "boom"}
+	tests := []struct {
+		name  string
+		setup func(c *MemoryCoordinator) error //Runs after a claimed the task
+		claim bool                             //Whether b can claim the task afterwards
+	}{
+		{"held", func(c *MemoryCoordinator) error {
+			return nil
+		}, false},
+		{"expired", func(c *MemoryCoordinator) error {
+			time.Sleep(2 * testttl)
+			return nil
+		}, true},
+		{"renewed", func(c *MemoryCoordinator) error {
+			for i := 0; i < 4; i++ {
+				time.Sleep(testttl / 2)
+				err := c.RenewTask("job", StageMap, 0, "a", testttl)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		}, false},
+		{"released", func(c *MemoryCoordinator) error {
+			return c.ReleaseTask("job", StageMap, 0, "a", attempt, time.Time{})
+		}, true},
+		{"retry after", func(c *MemoryCoordinator) error {
+			return c.ReleaseTask("job", StageMap, 0, "a", attempt, time.Now().Add(time.Minute))
+		}, false},
+		{"retry after passed", func(c *MemoryCoordinator) error {
+			err := c.ReleaseTask("job", StageMap, 0, "a", attempt, time.Now().Add(testttl))
+			time.Sleep(2 * testttl)
+			return err
+		}, true},
+		{"completed", func(c *MemoryCoordinator) error {
+			return c.CompleteTask("job", StageMap, 0, "a", map[int]string{0: "out"})
+		}, false},
+		{"failed", func(c *MemoryCoordinator) error {
+			return c.FailTask("job", StageMap, 0, "a", attempt)
+		}, false},
+	}
+	for _, test := range tests {
+		c := newtestcoordinator(t)
+		ok, err := c.ClaimTask("job", StageMap, 0, "input", "a", testttl)
+		if err != nil || !ok {
+			t.Fatalf("%s: first claim failed: %v %v", test.name, ok, err)
+		}
+		err = test.setup(c)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		ok, err = c.ClaimTask("job", StageMap, 0, "input", "b", testttl)
+		if err != nil || ok != test.claim {
+			t.Errorf("%s: claim got %v %v, want %v", test.name, ok, err, test.claim)
+		}
+	}
+}
+
+func TestMemoryCoordinatorLostLease(t *testing.T) {
+	attempt := &TaskAttempt{Owner: "a"}
+	tests := []struct {
+		name string
+		op   func(c *MemoryCoordinator) error
+	}{
+		{"renew", func(c *MemoryCoordinator) error {
+			return c.RenewTask("job", StageMap, 0, "a", testttl)
+		}},
+		{"complete", func(c *MemoryCoordinator) error {
+			return c.CompleteTask("job", StageMap, 0, "a", map[int]string{})
+		}},
+		{"release", func(c *MemoryCoordinator) error {
+			return c.ReleaseTask("job", StageMap, 0, "a", attempt, time.Time{})
+		}},
+		{"fail", func(c *MemoryCoordinator) error {
+			return c.FailTask("job", StageMap, 0, "a", attempt)
+		}},
+	}
+	for _, test := range tests {
+		//a's lease expires and b takes over
+		c := newtestcoordinator(t)
+		c.ClaimTask("job", StageMap, 0, "input", "a", testttl)
+		time.Sleep(2 * testttl)
+		ok, err := c.ClaimTask("job", StageMap, 0, "input", "b", time.Minute)
+		if err != nil || !ok {
+			t.Fatalf("%s: takeover failed: %v %v", test.name, ok, err)
+		}
+		err = test.op(c)
+		if err != ErrLostLease {
+			t.Errorf("%s: got %v, want ErrLostLease", test.name, err)
+		}
+		task, err := c.GetTask("job", StageMap, 0)
+		if err != nil || task.Owner != "b" || task.Status != StatusInitialized || !task.Leased {
+			t.Errorf("%s: task changed: %+v %v", test.name, task, err)
+		}
+	}
+}
+
+func TestMemoryCoordinatorAttempts(t *testing.T) {
+	c := newtestcoordinator(t)
+	for i, owner := range []string{"a", "b"} {
+		ok, err := c.ClaimTask("job", StageMap, 0, "input", owner, testttl)
+		if err != nil || !ok {
+			t.Fatalf("claim %d failed: %v %v", i, ok, err)
+		}
+		err = c.ReleaseTask("job", StageMap, 0, owner, &TaskAttempt{Owner: owner}, time.Time{})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	task, err := c.GetTask("job", StageMap, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(task.Attempts) != 2 || task.Attempts[0].Owner != "a" || task.Attempts[1].Owner != "b" {
+		t.Errorf("Unexpected attempts %+v", task.Attempts)
+	}
+	if task.Leased || task.Input != "input" {
+		t.Errorf("Unexpected task %+v", task)
+	}
+}
+
+func TestMemoryCoordinatorResults(t *testing.T) {
+	c := newtestcoordinator(t)
+	for id := 0; id < 2; id++ {
+		c.ClaimTask("job", StageReduce, id, "", "a", time.Minute)
+		err := c.CompleteTask("job", StageReduce, id, "a", map[int]string{id: "result"})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	results, err := c.Results("job")
+	if err != nil || !reflect.DeepEqual(results, map[int]string{0: "result", 1: "result"}) {
+		t.Errorf("Got results %v %v", results, err)
+	}
+	if _, err = c.GetJob("nojob"); err == nil {
+		t.Error("Got a job that doesn't exist")
+	}
+}
+
+func TestMemoryCoordinatorJobStatus(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		err    error
+	}{
+		{"map stage", StatusMapStage, nil},
+		{"failed", StatusFail, ErrJobFailed},
+		{"cancelled", StatusCancelled, ErrJobCancelled},
+	}
+	for _, test := range tests {
+		c := newtestcoordinator(t)
+		var err error
+		switch test.status {
+		case StatusFail:
+			err = c.FailJob("job", "reason", "map/0")
+		case StatusCancelled:
+			err = c.CancelJob("job")
+		default:
+			err = c.SetJobStatus("job", test.status)
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		err = c.SetJobStatus("job", StatusReduceStage)
+		if err != test.err {
+			t.Errorf("%s: got %v, want %v", test.name, err, test.err)
+		}
+	}
+}
+
+func TestMemoryCoordinatorFailJob(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		err    error
+	}{
+		{"running", StatusMapStage, nil},
+		{"failed", StatusFail, ErrJobFailed},
+		{"cancelled", StatusCancelled, ErrJobCancelled},
+	}
+	for _, test := range tests {
+		c := newtestcoordinator(t)
+		c.jobs["job"].info.Status = test.status
+		c.jobs["job"].info.FailReason = "first"
+		err := c.FailJob("job", "second", "map/0")
+		if err != test.err {
+			t.Errorf("%s: got %v, want %v", test.name, err, test.err)
+		}
+		info, _ := c.GetJob("job")
+		if test.err != nil && (info.Status != test.status || info.FailReason != "first") {
+			t.Errorf("%s: job changed to %d %s", test.name, info.Status, info.FailReason)
+		}
+		if test.err == nil && (info.Status != StatusFail || info.FailReason != "second") {
+			t.Errorf("%s: job not failed %d %s", test.name, info.Status, info.FailReason)
+		}
+	}
+	c := newtestcoordinator(t)
+	c.jobs["job"].info.Status = StatusDone
+	if c.FailJob("job", "reason", "map/0") == nil {
+		t.Error("Failed a finished job")
+	}
+}
+
+func TestMemoryCoordinatorWatch(t *testing.T) {
+	c := NewMemoryCoordinator()
+	stop := make(chan struct{})
+	defer close(stop)
+	changes, err := c.Watch(stop)
+	if err != nil {
+		t.Fatal(err)
+	}
+	woken := func() bool {
+		select {
+		case <-changes:
+			return true
+		default:
+			return false
+		}
+	}
+	attempt := &TaskAttempt{Owner: "a"}
+	tests := []struct {
+		name string
+		op   func() error
+		wake bool
+	}{
+		{"create job", func() error {
+			return c.CreateJob(&JobInfo{Name: "job", NumMaps: 1})
+		}, true},
+		{"map stage", func() error {
+			return c.SetJobStatus("job", StatusMapStage)
+		}, false},
+		{"claim", func() error {
+			_, err := c.ClaimTask("job", StageMap, 0, "input", "a", time.Minute)
+			return err
+		}, false},
+		{"release", func() error {
+			return c.ReleaseTask("job", StageMap, 0, "a", attempt, time.Time{})
+		}, true},
+		{"claim again", func() error {
+			_, err := c.ClaimTask("job", StageMap, 0, "input", "a", time.Minute)
+			return err
+		}, false},
+		{"complete", func() error {
+			return c.CompleteTask("job", StageMap, 0, "a", map[int]string{0: "out"})
+		}, true},
+		{"reduces", func() error {
+			return c.SetNumReduces("job", 1)
+		}, true},
+		{"cancel", func() error {
+			return c.CancelJob("job")
+		}, false},
+	}
+	for _, test := range tests {
+		err := test.op()
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if wake := woken(); wake != test.wake {
+			t.Errorf("%s: woke watchers %v, want %v", test.name, wake, test.wake)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package gomr
+
+import (
+	"context"
+	"github.com/coreos/go-etcd/etcd"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"path"
+)
+
+//Collect all leaf keys below node
+func etcdleaves(node *etcd.Node, kvs map[string]string) {
+	if !node.Dir {
+		kvs[node.Key] = node.Value
+		return
+	}
+	for _, child := range node.Nodes {
+		etcdleaves(child, kvs)
+	}
+}
+
+//Copies job trees from the etcd v2 keyspace into the v3 layout used by EtcdV3Coordinator.
+//
+//Workers should be stopped while migrating, tasks that were running under v2 become claimable
+//again in v3. The job status key is written last, so a job is only visible in v3 once all its
+//keys are copied. Jobs already present in v3 are skipped, making it safe to run again.
+//Returns the names of the migrated jobs.
+func MigrateEtcdV2ToV3(v2machines, v3endpoints []string) ([]string, error) {
+	migrated := []string{}
+	v2 := etcd.NewClient(v2machines)
+	defer v2.Close()
+	v3, err := NewEtcdV3Coordinator(v3endpoints)
+	if err != nil {
+		return migrated, err
+	}
+	defer v3.Close()
+	resp, err := v2.Get("/gomr/", false, true)
+	if err != nil {
+		if iserrorcode(err, etcdErrKeyNotFound) {
+			return migrated, nil
+		}
+		return migrated, err
+	}
+	for _, jobnode := range resp.Node.Nodes {
+		if !jobnode.Dir {
+			continue
+		}
+		jobname := path.Base(jobnode.Key)
+		statuskey := jobprefix(jobname) + "status"
+		ctx, cancel := v3.context()
+		existing, err := v3.client.Get(ctx, statuskey)
+		cancel()
+		if err != nil {
+			return migrated, err
+		}
+		if len(existing.Kvs) > 0 {
+			continue
+		}
+		kvs := make(map[string]string)
+		etcdleaves(jobnode, kvs)
+		status, ok := kvs[statuskey]
+		if !ok {
+			//Deploy never finished for this one
+			continue
+		}
+		delete(kvs, statuskey)
+		ops := []clientv3.Op{}
+		for key, value := range kvs {
+			//v2 leases have no meaning in v3, which uses lease attached locks
+			if path.Base(key) == "lease" {
+				continue
+			}
+			ops = append(ops, clientv3.OpPut(key, value))
+		}
+		for len(ops) > 0 {
+			n := len(ops)
+			if n > txnBatchSize {
+				n = txnBatchSize
+			}
+			err = v3txn(v3, ops[:n])
+			if err != nil {
+				return migrated, err
+			}
+			ops = ops[n:]
+		}
+		err = v3txn(v3, []clientv3.Op{clientv3.OpPut(statuskey, status)})
+		if err != nil {
+			return migrated, err
+		}
+		migrated = append(migrated, jobname)
+	}
+	return migrated, nil
+}
+
+func v3txn(c *EtcdV3Coordinator, ops []clientv3.Op) error {
+	ctx, cancel := context.WithTimeout(context.Background(), etcdv3Timeout)
+	defer cancel()
+	_, err := c.client.Txn(ctx).Then(ops...).Commit()
+	return err
+}
@@ -0,0 +1,254 @@
+package gomr
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"strings"
+)
+
+//Formats of reduce results, see Job.OutputFormat
+const (
+	OutputTSV     = "tsv"     //One "key\tvalue" line per pair, the default. Keys must not contain tabs or newlines, values no newlines
+	OutputCSV     = "csv"     //Two column CSV, quoted where needed
+	OutputJSONL   = "jsonl"   //One {"key":...,"value":...} object per line
+	OutputRecords = "records" //Key and value each prefixed with their length as uvarint, like intermediate outputs
+)
+
+//Writes key/value pairs in one of the Output formats
+type OutputWriter interface {
+	Write(key, value string) error
+	Flush() error //Must be called once done, doesn't close the underlying writer
+}
+
+//Reads key/value pairs written by an OutputWriter
+//
+//	for pairs.Next() {
+//		key, value := pairs.Key(), pairs.Value()
+//		...
+//	}
+//	err := pairs.Err()
+type OutputReader interface {
+	Next() bool
+	Key() string
+	Value() string
+	Err() error
+}
+
+//Pair as stored by OutputJSONL
+type jsonpair struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+func checkoutputformat(format string) error {
+	switch format {
+	case "", OutputTSV, OutputCSV, OutputJSONL, OutputRecords:
+		return nil
+	}
+	return errors.New("Unknown output format '" + format + "'")
+}
+
+type tsvwriter struct {
+	w *bufio.Writer
+}
+
+func (t *tsvwriter) Write(key, value string) error {
+	_, err := t.w.WriteString(key + "\t" + value + "\n")
+	return err
+}
+
+func (t *tsvwriter) Flush() error {
+	return t.w.Flush()
+}
+
+type csvwriter struct {
+	w *csv.Writer
+}
+
+func (c *csvwriter) Write(key, value string) error {
+	return c.w.Write([]string{key, value})
+}
+
+func (c *csvwriter) Flush() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+type jsonlwriter struct {
+	w   *bufio.Writer
+	enc *json.Encoder
+}
+
+func (j *jsonlwriter) Write(key, value string) error {
+	//Encode adds the newline
+	return j.enc.Encode(jsonpair{key, value})
+}
+
+func (j *jsonlwriter) Flush() error {
+	return j.w.Flush()
+}
+
+type recordswriter struct {
+	w *bufio.Writer
+}
+
+func (r *recordswriter) Write(key, value string) error {
+	return writerecord(r.w, key, value)
+}
+
+func (r *recordswriter) Flush() error {
+	return r.w.Flush()
+}
+
+//Writer for one of the Output formats, OutputTSV if format is empty
+func NewOutputWriter(format string, w io.Writer) (OutputWriter, error) {
+	err := checkoutputformat(format)
+	if err != nil {
+		return nil, err
+	}
+	if format == OutputCSV {
+		return &csvwriter{csv.NewWriter(w)}, nil
+	}
+	bw := bufio.NewWriter(w)
+	switch format {
+	case OutputJSONL:
+		enc := json.NewEncoder(bw)
+		enc.SetEscapeHTML(false)
+		return &jsonlwriter{bw, enc}, nil
+	case OutputRecords:
+		return &recordswriter{bw}, nil
+	}
+	return &tsvwriter{bw}, nil
+}
+
+//Wraps a function reading one pair at a time
+type outputreader struct {
+	read  func() (string, string, error)
+	key   string
+	value string
+	err   error
+}
+
+func (o *outputreader) Next() bool {
+	if o.err != nil {
+		return false
+	}
+	o.key, o.value, o.err = o.read()
+	return o.err == nil
+}
+
+func (o *outputreader) Key() string {
+	return o.key
+}
+
+func (o *outputreader) Value() string {
+	return o.value
+}
+
+func (o *outputreader) Err() error {
+	if o.err == io.EOF {
+		return nil
+	}
+	return o.err
+}
+
+//Reader for one of the Output formats, OutputTSV if format is empty
+func NewOutputReader(format string, r io.Reader) (OutputReader, error) {
+	err := checkoutputformat(format)
+	if err != nil {
+		return nil, err
+	}
+	br := bufio.NewReader(r)
+	switch format {
+	case OutputCSV:
+		cr := csv.NewReader(br)
+		cr.FieldsPerRecord = 2
+		return &outputreader{read: func() (string, string, error) {
+			fields, err := cr.Read()
+			if err != nil {
+				return "", "", err
+			}
+			return fields[0], fields[1], nil
+		}}, nil
+	case OutputJSONL:
+		dec := json.NewDecoder(br)
+		return &outputreader{read: func() (string, string, error) {
+			pair := jsonpair{}
+			err := dec.Decode(&pair)
+			return pair.Key, pair.Value, err
+		}}, nil
+	case OutputRecords:
+		return &outputreader{read: func() (string, string, error) {
+			rec, err := readrecord(br)
+			return rec.key, rec.value, err
+		}}, nil
+	}
+	return &outputreader{read: func() (string, string, error) {
+		line, err := readline(br)
+		if err != nil {
+			return "", "", err
+		}
+		parts := strings.SplitN(line, "\t", 2)
+		if len(parts) != 2 {
+			return "", "", errors.New("Invalid tsv line '" + line + "'")
+		}
+		return parts[0], parts[1], nil
+	}}, nil
+}
+
+//Decode the results of the given partitions of a finished job, all if empty, and write them
+//to w in format. header is written as first row and is only allowed for OutputCSV and OutputTSV
+func (j *Job) ExportResults(w io.Writer, format string, header []string, partitions []int) error {
+	if format == "" {
+		format = OutputTSV
+	}
+	if len(header) > 0 && format != OutputCSV && format != OutputTSV {
+		return errors.New("Headers are only supported for csv and tsv")
+	}
+	if len(header) > 0 && len(header) != 2 {
+		return errors.New("The header needs a name for the key and the value column")
+	}
+	out, err := NewOutputWriter(format, w)
+	if err != nil {
+		return err
+	}
+	pairs, err := j.ResultPairs(partitions)
+	if err != nil {
+		return err
+	}
+	defer pairs.Close()
+	if len(header) > 0 {
+		err = out.Write(header[0], header[1])
+		if err != nil {
+			return err
+		}
+	}
+	for pairs.Next() {
+		err = out.Write(pairs.Key(), pairs.Value())
+		if err != nil {
+			return err
+		}
+	}
+	if pairs.Err() != nil {
+		return pairs.Err()
+	}
+	return out.Flush()
+}
+
+//Like FetchResults, but converts the results to format, see ExportResults
+func (j *Job) FetchResultsAs(fname, format string, header []string, partitions []int) error {
+	f, err := os.Create(fname)
+	if err != nil {
+		return err
+	}
+	err = j.ExportResults(f, format, header, partitions)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
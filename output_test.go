@@ -0,0 +1,87 @@
+package gomr
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestOutputFormats(t *testing.T) {
+	pairs := [][2]string{{"a", "1"}, {"key with, comma", "value \"quoted\""}, {"", ""}, {"unicode ✓", "<tag>"}}
+	for _, format := range []string{"", OutputTSV, OutputCSV, OutputJSONL, OutputRecords} {
+		buf := &bytes.Buffer{}
+		w, err := NewOutputWriter(format, buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, pair := range pairs {
+			err = w.Write(pair[0], pair[1])
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		err = w.Flush()
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, err := NewOutputReader(format, buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := [][2]string{}
+		for r.Next() {
+			got = append(got, [2]string{r.Key(), r.Value()})
+		}
+		if r.Err() != nil || !reflect.DeepEqual(got, pairs) {
+			t.Errorf("%q: got %q %v", format, got, r.Err())
+		}
+	}
+	_, err := NewOutputWriter("xml", &bytes.Buffer{})
+	if err == nil {
+		t.Error("Unknown format accepted")
+	}
+}
+
+func TestExportResults(t *testing.T) {
+	dir, inputs := testinputs(t, "b a b\n")
+	defer os.RemoveAll(dir)
+	store, err := ioutil.TempDir("", "gomr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(store)
+	w := &EmitWorker{MapRecord: wordcountmap, Reduce: wordcountreduce}
+	job := &Job{Inputs: inputs, Partitions: 1}
+	_, err = runlocal(t, &LocalRunner{Worker: w.Worker(), Dir: store}, job)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		format string
+		header []string
+		output string //Empty if exporting fails
+	}{
+		{"", nil, "a\t1\nb\t2\n"},
+		{"", []string{"word", "count"}, "word\tcount\na\t1\nb\t2\n"},
+		{OutputTSV, []string{"word", "count"}, "word\tcount\na\t1\nb\t2\n"},
+		{OutputCSV, []string{"word", "count"}, "word,count\na,1\nb,2\n"},
+		{OutputJSONL, nil, "{\"key\":\"a\",\"value\":\"1\"}\n{\"key\":\"b\",\"value\":\"2\"}\n"},
+		{OutputJSONL, []string{"word", "count"}, ""},
+		{OutputCSV, []string{"word"}, ""},
+	}
+	for _, test := range tests {
+		buf := &bytes.Buffer{}
+		err = job.ExportResults(buf, test.format, test.header, nil)
+		if test.output == "" {
+			if err == nil {
+				t.Errorf("%q %v: expected an error", test.format, test.header)
+			}
+			continue
+		}
+		if err != nil || buf.String() != test.output {
+			t.Errorf("%q %v: got %q %v, want %q", test.format, test.header, buf.String(), err, test.output)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package gomr
+
+import (
+	"errors"
+	"hash/fnv"
+	"sort"
+	"sync"
+)
+
+//Assigns keys emitted by Map to one of n partitions, each partition is handled by one reduce task
+type Partitioner interface {
+	Partition(key string, n int) int
+}
+
+//Default partitioner, spreads keys evenly using their FNV-1a hash
+type HashPartitioner struct{}
+
+func (HashPartitioner) Partition(key string, n int) int {
+	if n < 1 {
+		return 0
+	}
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % uint32(n))
+}
+
+//Keeps keys sorted across partitions. Partition i holds keys from SplitPoints[i-1]
+//up to but excluding SplitPoints[i], so concatenating the results in order is sorted as well.
+//Use len(SplitPoints)+1 partitions, keys past the last partition are put in it
+type RangePartitioner struct {
+	SplitPoints []string //Sorted
+}
+
+func (p RangePartitioner) Partition(key string, n int) int {
+	i := sort.Search(len(p.SplitPoints), func(i int) bool { return p.SplitPoints[i] > key })
+	if n > 0 && i >= n {
+		return n - 1
+	}
+	return i
+}
+
+var (
+	partitionersmu sync.Mutex
+	partitioners   = map[string]Partitioner{
+		"hash": HashPartitioner{},
+	}
+)
+
+//Make a custom partitioner available to jobs as Job.Partitioner = name.
+//It must be registered in the job binary, e.g. in main before calling Execute
+func RegisterPartitioner(name string, p Partitioner) {
+	partitionersmu.Lock()
+	defer partitionersmu.Unlock()
+	partitioners[name] = p
+}
+
+//Partitioner the job asked for. "" and "hash" give HashPartitioner, "range" a
+//RangePartitioner using Job.SplitPoints, anything else must have been registered
+func (j *Job) GetPartitioner() (Partitioner, error) {
+	switch j.Partitioner {
+	case "":
+		return HashPartitioner{}, nil
+	case "range":
+		return RangePartitioner{j.SplitPoints}, nil
+	}
+	partitionersmu.Lock()
+	defer partitionersmu.Unlock()
+	p, ok := partitioners[j.Partitioner]
+	if !ok {
+		return nil, errors.New("Unknown partitioner '" + j.Partitioner + "'")
+	}
+	return p, nil
+}
@@ -0,0 +1,268 @@
+package gomr
+
+import (
+	"bufio"
+	"compress/bzip2"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"github.com/klauspost/compress/zstd"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+//Formats understood by NewRecordReader
+const (
+	FormatLines  = "lines"  //One record per line, without the line ending
+	FormatCSV    = "csv"    //Comma separated values, the fields of each row are in Record.Fields
+	FormatTSV    = "tsv"    //Tab separated values without quoting, the fields of each row are in Record.Fields
+	FormatJSONL  = "jsonl"  //One JSON document per line, blank lines are skipped. See Record.Decode
+	FormatBinary = "binary" //Records prefixed with their length as uvarint
+)
+
+//A single record of an input
+type Record struct {
+	Data   string   //The raw record, a line or JSON document without line ending or the bytes of a binary record. CSV rows are rebuilt from Fields
+	Fields []string //Fields of csv and tsv records
+}
+
+//Unmarshal a jsonl record into v
+func (r *Record) Decode(v interface{}) error {
+	return json.Unmarshal([]byte(r.Data), v)
+}
+
+//Iterates over the records of an input
+//
+//	for records.Next() {
+//		rec := records.Record()
+//		...
+//	}
+//	err := records.Err()
+type RecordReader interface {
+	Next() bool      //Advances to the next record, false at the end of the input or on error
+	Record() *Record //The current record, only valid until the next call to Next
+	Err() error      //First error reading the input, if any
+	Close() error    //Close the underlying input
+}
+
+//Called once per record by EmitWorker.MapRecord
+type RecordMapFunc func(rec *Record, emit EmitFunc, job *Job, logger Logger) error
+
+//Wraps a reader reading one record at a time
+type recordreader struct {
+	rd   io.ReadCloser
+	read func() (*Record, error)
+	rec  *Record
+	err  error
+}
+
+func (r *recordreader) Next() bool {
+	if r.err != nil {
+		return false
+	}
+	r.rec, r.err = r.read()
+	return r.err == nil
+}
+
+func (r *recordreader) Record() *Record {
+	return r.rec
+}
+
+func (r *recordreader) Err() error {
+	if r.err == io.EOF {
+		return nil
+	}
+	return r.err
+}
+
+func (r *recordreader) Close() error {
+	return r.rd.Close()
+}
+
+//Read one line without its line ending, io.EOF once there are no more
+func readline(br *bufio.Reader) (string, error) {
+	line, err := br.ReadString('\n')
+	if err == io.EOF && line != "" {
+		err = nil
+	}
+	if err != nil {
+		return "", err
+	}
+	line = strings.TrimSuffix(line, "\n")
+	return strings.TrimSuffix(line, "\r"), nil
+}
+
+//Reads newline separated text
+func NewLineReader(rd io.ReadCloser) RecordReader {
+	br := bufio.NewReader(rd)
+	return &recordreader{rd: rd, read: func() (*Record, error) {
+		line, err := readline(br)
+		if err != nil {
+			return nil, err
+		}
+		return &Record{Data: line}, nil
+	}}
+}
+
+//Reads one JSON document per line. Documents are checked to be valid JSON
+func NewJSONLinesReader(rd io.ReadCloser) RecordReader {
+	br := bufio.NewReader(rd)
+	n := 0
+	return &recordreader{rd: rd, read: func() (*Record, error) {
+		for {
+			line, err := readline(br)
+			if err != nil {
+				return nil, err
+			}
+			n++
+			if strings.TrimSpace(line) == "" {
+				continue
+			}
+			if !json.Valid([]byte(line)) {
+				return nil, errors.New("Invalid JSON on line " + strconv.Itoa(n))
+			}
+			return &Record{Data: line}, nil
+		}
+	}}
+}
+
+//Reads CSV style rows separated by comma, fields may be quoted and contain newlines.
+//Rows may have different numbers of fields. Record.Data is the fields joined by comma,
+//without quotes, rather than the row as it was read
+func NewDelimitedReader(rd io.ReadCloser, comma rune) RecordReader {
+	r := csv.NewReader(rd)
+	r.Comma = comma
+	r.FieldsPerRecord = -1
+	return &recordreader{rd: rd, read: func() (*Record, error) {
+		fields, err := r.Read()
+		if err != nil {
+			return nil, err
+		}
+		return &Record{Data: strings.Join(fields, string(comma)), Fields: fields}, nil
+	}}
+}
+
+//Reads tab separated rows, one per line. There is no quoting, quotes are part of the fields.
+//Record.Data is the line without its line ending
+func NewTSVReader(rd io.ReadCloser) RecordReader {
+	br := bufio.NewReader(rd)
+	return &recordreader{rd: rd, read: func() (*Record, error) {
+		line, err := readline(br)
+		if err != nil {
+			return nil, err
+		}
+		return &Record{Data: line, Fields: strings.Split(line, "\t")}, nil
+	}}
+}
+
+//Reads records each prefixed with their length as uvarint, as written by binary.PutUvarint
+func NewBinaryReader(rd io.ReadCloser) RecordReader {
+	br := bufio.NewReader(rd)
+	return &recordreader{rd: rd, read: func() (*Record, error) {
+		n, err := binary.ReadUvarint(br)
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, n)
+		_, err = io.ReadFull(br, buf)
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &Record{Data: string(buf)}, nil
+	}}
+}
+
+//Reader for one of the Format constants, reading already uncompressed data
+func NewRecordReader(format string, rd io.ReadCloser) (RecordReader, error) {
+	switch format {
+	case "", FormatLines:
+		return NewLineReader(rd), nil
+	case FormatCSV:
+		return NewDelimitedReader(rd, ','), nil
+	case FormatTSV:
+		return NewTSVReader(rd), nil
+	case FormatJSONL:
+		return NewJSONLinesReader(rd), nil
+	case FormatBinary:
+		return NewBinaryReader(rd), nil
+	}
+	return nil, errors.New("Unknown record format '" + format + "'")
+}
+
+//Read the records of a map input. Inputs are fetched and uncompressed by Job.OpenInput, so
+//this works for split inputs as well as http(s) URLs, s3://bucket/key and local paths.
+//Binary records can't be split at arbitrary offsets, use them with Job.InputFormat = "whole"
+func (j *Job) OpenRecords(input, format string) (RecordReader, error) {
+	rd, err := j.OpenInput(input)
+	if err != nil {
+		return nil, err
+	}
+	records, err := NewRecordReader(format, rd)
+	if err != nil {
+		rd.Close()
+		return nil, err
+	}
+	return records, nil
+}
+
+//Whether the input is compressed in a format decompress understands
+func iscompressed(input string) bool {
+	switch path.Ext(input) {
+	case ".gz", ".bz2", ".zst", ".zstd":
+		return true
+	}
+	return false
+}
+
+//Closes the decompressor along with the compressed stream
+type decompressor struct {
+	io.Reader
+	close func()
+	rd    io.ReadCloser
+}
+
+func (d *decompressor) Close() error {
+	if d.close != nil {
+		d.close()
+	}
+	return d.rd.Close()
+}
+
+//Uncompress rd according to the extension of input, .gz, .bz2, .zst or .zstd. Anything else is returned as is
+func decompress(input string, rd io.ReadCloser) (io.ReadCloser, error) {
+	switch path.Ext(input) {
+	case ".gz":
+		gzrd, err := gzip.NewReader(rd)
+		if err != nil {
+			rd.Close()
+			return nil, err
+		}
+		return &decompressor{gzrd, func() { gzrd.Close() }, rd}, nil
+	case ".bz2":
+		return &decompressor{bzip2.NewReader(rd), nil, rd}, nil
+	case ".zst", ".zstd":
+		zrd, err := zstd.NewReader(rd)
+		if err != nil {
+			rd.Close()
+			return nil, err
+		}
+		return &decompressor{zrd, zrd.Close, rd}, nil
+	}
+	return rd, nil
+}
+
+//Open a whole input and uncompress it if its name says it is compressed. See InputSize for supported inputs
+func (env *Environment) OpenDecompressed(input string) (io.ReadCloser, error) {
+	rd, err := env.OpenInputRange(input, 0, -1)
+	if err != nil {
+		return nil, err
+	}
+	return decompress(input, rd)
+}
@@ -0,0 +1,63 @@
+package gomr
+
+import (
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDelimitedRecords(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  string
+		content string
+		data    []string
+		fields  [][]string
+	}{
+		{"csv", FormatCSV, "a,b\nc,d\n",
+			[]string{"a,b", "c,d"}, [][]string{{"a", "b"}, {"c", "d"}}},
+		{"csv quotes", FormatCSV, "\"a,b\",\"say \"\"hi\"\"\"\n",
+			[]string{"a,b,say \"hi\""}, [][]string{{"a,b", "say \"hi\""}}},
+		{"csv quoted newline", FormatCSV, "\"a\nb\",c\n",
+			[]string{"a\nb,c"}, [][]string{{"a\nb", "c"}}},
+		{"csv tabs", FormatCSV, "a\tb,c\n",
+			[]string{"a\tb,c"}, [][]string{{"a\tb", "c"}}},
+		{"csv crlf", FormatCSV, "a,b\r\nc,d\r\n",
+			[]string{"a,b", "c,d"}, [][]string{{"a", "b"}, {"c", "d"}}},
+		{"csv uneven rows", FormatCSV, "a\nb,c\n",
+			[]string{"a", "b,c"}, [][]string{{"a"}, {"b", "c"}}},
+		{"tsv", FormatTSV, "a\tb\nc\td",
+			[]string{"a\tb", "c\td"}, [][]string{{"a", "b"}, {"c", "d"}}},
+		{"tsv quotes", FormatTSV, "\"a\tb\"\tsay \"hi\"\n",
+			[]string{"\"a\tb\"\tsay \"hi\""}, [][]string{{"\"a", "b\"", "say \"hi\""}}},
+		{"tsv commas", FormatTSV, "a,b\tc\n",
+			[]string{"a,b\tc"}, [][]string{{"a,b", "c"}}},
+		{"tsv empty fields", FormatTSV, "\ta\t\n",
+			[]string{"\ta\t"}, [][]string{{"", "a", ""}}},
+		{"tsv crlf", FormatTSV, "a\tb\r\nc\td\r\n",
+			[]string{"a\tb", "c\td"}, [][]string{{"a", "b"}, {"c", "d"}}},
+	}
+	for _, test := range tests {
+		rd, err := NewRecordReader(test.format, ioutil.NopCloser(strings.NewReader(test.content)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		data := []string{}
+		fields := [][]string{}
+		for rd.Next() {
+			data = append(data, rd.Record().Data)
+			fields = append(fields, rd.Record().Fields)
+		}
+		if rd.Err() != nil {
+			t.Errorf("%s: %v", test.name, rd.Err())
+		}
+		rd.Close()
+		if !reflect.DeepEqual(data, test.data) {
+			t.Errorf("%s: got data %q, want %q", test.name, data, test.data)
+		}
+		if !reflect.DeepEqual(fields, test.fields) {
+			t.Errorf("%s: got fields %q, want %q", test.name, fields, test.fields)
+		}
+	}
+}
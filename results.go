@@ -0,0 +1,212 @@
+package gomr
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+//Key of the result of partition, an error if the job has none
+func (j *Job) resultkey(partition int) (string, error) {
+	for i, p := range j.ResultParts {
+		if p == partition && i < len(j.Results) {
+			return j.Results[i], nil
+		}
+	}
+	return "", fmt.Errorf("Partition %d has no result", partition)
+}
+
+//Stream the uncompressed result of a single partition. Partitions no key was emitted for,
+//and those of failed reduce tasks, have no result
+func (j *Job) OpenPartition(partition int) (io.ReadCloser, error) {
+	key, err := j.resultkey(partition)
+	if err != nil {
+		return nil, err
+	}
+	store, err := j.environment().GetBlobStore(j.S3Bucket)
+	if err != nil {
+		return nil, err
+	}
+	rd, err := store.GetReader(key)
+	if err != nil {
+		return nil, err
+	}
+	gzrd, err := gzip.NewReader(rd)
+	if err != nil {
+		rd.Close()
+		return nil, err
+	}
+	return &decompressor{gzrd, func() { gzrd.Close() }, rd}, nil
+}
+
+//Reads the results of several partitions one after the other, as if they were a single file.
+//Only one partition is downloaded at a time
+type ResultsReader struct {
+	job        *Job
+	partitions []int
+	current    io.ReadCloser
+	partition  int
+}
+
+//Partitions to read, all with a result if none are given. Errors if the job isn't done or a partition has no result
+func (j *Job) resultpartitions(partitions []int) ([]int, error) {
+	if j.Status != StatusDone {
+		return nil, fmt.Errorf("Job %s isn't done", j.Name)
+	}
+	if len(partitions) == 0 {
+		partitions = j.ResultParts
+	}
+	for _, p := range partitions {
+		_, err := j.resultkey(p)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return append([]int{}, partitions...), nil
+}
+
+//Stream the uncompressed results of the given partitions in that order, all partitions with
+//a result in partition order if partitions is empty. The job must be done
+func (j *Job) OpenResults(partitions []int) (*ResultsReader, error) {
+	partitions, err := j.resultpartitions(partitions)
+	if err != nil {
+		return nil, err
+	}
+	return &ResultsReader{job: j, partitions: partitions, partition: -1}, nil
+}
+
+func (r *ResultsReader) Read(p []byte) (int, error) {
+	for {
+		if r.current == nil {
+			if len(r.partitions) == 0 {
+				r.partition = -1
+				return 0, io.EOF
+			}
+			rd, err := r.job.OpenPartition(r.partitions[0])
+			if err != nil {
+				return 0, err
+			}
+			r.current, r.partition, r.partitions = rd, r.partitions[0], r.partitions[1:]
+		}
+		n, err := r.current.Read(p)
+		if err == io.EOF {
+			err = r.current.Close()
+			r.current = nil
+			if err != nil {
+				return n, err
+			}
+			if n == 0 {
+				continue
+			}
+		}
+		return n, err
+	}
+}
+
+//Partition being read, -1 before the first Read and at the end
+func (r *ResultsReader) Partition() int {
+	return r.partition
+}
+
+func (r *ResultsReader) Close() error {
+	r.partitions = nil
+	if r.current == nil {
+		return nil
+	}
+	err := r.current.Close()
+	r.current = nil
+	return err
+}
+
+//Decoded key/value pairs of results, see Job.ResultPairs
+type ResultPairs struct {
+	OutputReader
+	rd *ResultsReader
+}
+
+func (r *ResultPairs) Close() error {
+	return r.rd.Close()
+}
+
+//Iterate over the key/value pairs of the given partitions, decoded according to Job.OutputFormat.
+//Partitions are read as in OpenResults. The iterator must be closed once done
+//
+//	pairs, err := job.ResultPairs(nil)
+//	...
+//	defer pairs.Close()
+//	for pairs.Next() {
+//		key, value := pairs.Key(), pairs.Value()
+//	}
+//	err = pairs.Err()
+func (j *Job) ResultPairs(partitions []int) (*ResultPairs, error) {
+	rd, err := j.OpenResults(partitions)
+	if err != nil {
+		return nil, err
+	}
+	pairs, err := NewOutputReader(j.OutputFormat, rd)
+	if err != nil {
+		return nil, err
+	}
+	return &ResultPairs{pairs, rd}, nil
+}
+
+//Name of the file FetchPartitions stores partition in
+func PartitionFile(partition int) string {
+	return fmt.Sprintf("part-%05d", partition)
+}
+
+//Download the results of the given partitions, all if empty, into dir as one file per
+//partition named by PartitionFile. Partitions are written to a temporary file first and
+//those already in dir are skipped, so an interrupted fetch resumes where it stopped.
+//Returns the files in partition order
+func (j *Job) FetchPartitions(dir string, partitions []int) ([]string, error) {
+	//Fail early on partitions that don't exist
+	partitions, err := j.resultpartitions(partitions)
+	if err != nil {
+		return nil, err
+	}
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+	files := []string{}
+	for _, p := range partitions {
+		fname := filepath.Join(dir, PartitionFile(p))
+		files = append(files, fname)
+		_, err = os.Stat(fname)
+		if err == nil {
+			continue
+		}
+		err = j.fetchpartition(p, fname)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+func (j *Job) fetchpartition(partition int, fname string) error {
+	rd, err := j.OpenPartition(partition)
+	if err != nil {
+		return err
+	}
+	defer rd.Close()
+	f, err := ioutil.TempFile(filepath.Dir(fname), ".partial")
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, rd)
+	if err == nil {
+		err = f.Close()
+	} else {
+		f.Close()
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), fname)
+}
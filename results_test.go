@@ -0,0 +1,54 @@
+package gomr
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFetchPartitionsResume(t *testing.T) {
+	dir, inputs := testinputs(t, "a b c d e f g h\n")
+	defer os.RemoveAll(dir)
+	w := &EmitWorker{MapRecord: wordcountmap, Reduce: wordcountreduce}
+	job := &Job{Inputs: inputs, Partitions: 2}
+	_, err := runlocal(t, &LocalRunner{Worker: w.Worker(), Dir: filepath.Join(dir, "store")}, job)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(dir, "out")
+	files, err := job.FetchPartitions(out, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 || files[0] != filepath.Join(out, PartitionFile(0)) || files[1] != filepath.Join(out, PartitionFile(1)) {
+		t.Fatalf("Got files %v", files)
+	}
+	want, err := ioutil.ReadFile(files[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	//Pretend the first fetch stopped after partition 0
+	err = ioutil.WriteFile(files[0], []byte("fetched before"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Remove(files[1])
+	_, err = job.FetchPartitions(out, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadFile(files[0])
+	if err != nil || string(got) != "fetched before" {
+		t.Errorf("Partition 0 was fetched again: %q %v", got, err)
+	}
+	got, err = ioutil.ReadFile(files[1])
+	if err != nil || string(got) != string(want) || len(got) == 0 {
+		t.Errorf("Partition 1 got %q %v, want %q", got, err, want)
+	}
+	//No temporary files are left behind
+	entries, err := ioutil.ReadDir(out)
+	if err != nil || len(entries) != 2 {
+		t.Errorf("Got %d files in %s: %v", len(entries), out, err)
+	}
+}
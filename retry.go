@@ -0,0 +1,121 @@
+package gomr
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+//Controls how often a failing map or reduce task is attempted before giving up on it
+type RetryPolicy struct {
+	MaxAttempts int           //Total attempts per task including the first one. 0 or 1 means no retries
+	Backoff     time.Duration //Wait before the first retry, doubled for every further retry
+	MaxBackoff  time.Duration //Optional - Upper limit of the wait between retries
+}
+
+//Total attempts allowed per task
+func (p *RetryPolicy) attempts() int {
+	if p == nil || p.MaxAttempts < 1 {
+		return 1
+	}
+	return p.MaxAttempts
+}
+
+//Wait before the next attempt after the given number of failures
+func (p *RetryPolicy) backoff(failures int) time.Duration {
+	if p == nil || p.Backoff <= 0 {
+		return 0
+	}
+	wait := p.Backoff
+	for i := 1; i < failures; i++ {
+		wait *= 2
+		if p.MaxBackoff > 0 && wait >= p.MaxBackoff {
+			return p.MaxBackoff
+		}
+	}
+	if p.MaxBackoff > 0 && wait > p.MaxBackoff {
+		return p.MaxBackoff
+	}
+	return wait
+}
+
+//A failed attempt at running a task, kept in the coordinator for troubleshooting
+type TaskAttempt struct {
+	Owner    string    //Owner ID of the worker that ran it
+	Host     string    //Hostname of the worker that ran it
+	Error    string    //What Map or Reduce returned
+	Started  time.Time //When Map or Reduce was called
+	Finished time.Time //When it returned
+}
+
+//Sort attempts by start time
+type attemptsbytime []*TaskAttempt
+
+func (a attemptsbytime) Len() int           { return len(a) }
+func (a attemptsbytime) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a attemptsbytime) Less(i, j int) bool { return a[i].Started.Before(a[j].Started) }
+
+//Records a failed attempt. The task is released for a retry after the backoff, or marked
+//StatusFail once the job's RetryPolicy is exhausted. If that puts the job over its
+//MaxFailedTasks budget the whole job is failed and ErrJobFailed returned
+func failtask(co Coordinator, j *Job, jobname, stage string, id int, owner string, started time.Time, taskerr error, logger Logger) error {
+	task, err := co.GetTask(jobname, stage, id)
+	if err != nil {
+		return err
+	}
+	hostname, _ := os.Hostname()
+	attempt := &TaskAttempt{
+		Owner:    owner,
+		Host:     hostname,
+		Error:    taskerr.Error(),
+		Started:  started,
+		Finished: time.Now(),
+	}
+	failures := 1
+	if task != nil {
+		failures += len(task.Attempts)
+	}
+	if failures >= j.Retry.attempts() {
+		logger.Critical(stage, "task", id, "failed", failures, "times, giving up on it")
+		err = co.FailTask(jobname, stage, id, owner, attempt)
+		if err != nil {
+			return err
+		}
+		failed, err := countfailedtasks(co, jobname)
+		if err != nil {
+			return err
+		}
+		//Nothing can run without split points, so a failed sample task always fails the job
+		if failed <= j.MaxFailedTasks && stage != StageSample {
+			logger.Info(failed, "tasks failed, job allows", j.MaxFailedTasks)
+			return nil
+		}
+		reason := fmt.Sprintf("%s task %d failed %d times: %s", stage, id, failures, taskerr)
+		logger.Critical("Failing job,", reason)
+		err = co.FailJob(jobname, reason, fmt.Sprintf("%s/%d", stage, id))
+		if err != nil {
+			return err
+		}
+		return ErrJobFailed
+	}
+	wait := j.Retry.backoff(failures)
+	logger.Info(stage, "task", id, "failed", failures, "times, will be retried in", wait)
+	return co.ReleaseTask(jobname, stage, id, owner, attempt, time.Now().Add(wait))
+}
+
+//Number of tasks across all stages that ran out of attempts
+func countfailedtasks(co Coordinator, jobname string) (int, error) {
+	failed := 0
+	for _, stage := range []string{StageSample, StageMap, StageReduce} {
+		tasks, err := co.ListTasks(jobname, stage)
+		if err != nil {
+			return 0, err
+		}
+		for _, task := range tasks {
+			if task.Status == StatusFail {
+				failed++
+			}
+		}
+	}
+	return failed, nil
+}
@@ -0,0 +1,167 @@
+package gomr
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"math"
+	"time"
+)
+
+//Stage of the single task computing range split points before the map stage
+const StageSample = "sample"
+
+//Returned while the sample task hasn't finished yet
+var errSampling = errors.New("Sampling not finished")
+
+//Returned by EmitWorker when a sampled job would be partitioned by its own Partitioner
+var errSamplePartitioner = errors.New("EmitWorker.Partitioner can't be used with SampleFraction, sampled jobs use the range partitioner")
+
+//Evenly spread subset of the inputs, at least one
+func sampleinputs(inputs []string, fraction float64) []string {
+	n := int(math.Ceil(float64(len(inputs)) * fraction))
+	if n < 1 {
+		n = 1
+	}
+	if n >= len(inputs) {
+		return inputs
+	}
+	sampled := []string{}
+	for i := 0; i < n; i++ {
+		sampled = append(sampled, inputs[i*len(inputs)/n])
+	}
+	return sampled
+}
+
+//Runs the sample task unless somebody else did already, then loads the split points into j
+//so map tasks use the range partitioner. errSampling means somebody else is still at it.
+//Jobs whose binary can't sample are failed, the sample task would never finish otherwise
+func (w *Worker) splitpoints(co Coordinator, store BlobStore, j *Job, jobname, owner string, ttl time.Duration, logger Logger) error {
+	if w.Sample == nil {
+		reason := "Job wants sampling but the worker has no Sample function"
+		logger.Critical("Failing job,", reason)
+		err := co.FailJob(jobname, reason, StageSample+"/0")
+		if err != nil {
+			return err
+		}
+		return ErrJobFailed
+	}
+	err := checkjob(co, jobname)
+	if err != nil {
+		return err
+	}
+	ok, err := co.ClaimTask(jobname, StageSample, 0, "", owner, ttl)
+	if err != nil {
+		return err
+	}
+	if ok {
+		logger.Info("Aquired lease for sample task as", owner)
+		inputs := sampleinputs(j.Inputs, j.SampleFraction)
+		logger.Info("Sampling", len(inputs), "of", len(j.Inputs), "inputs")
+		hb := startheartbeat(co, j, jobname, StageSample, 0, owner, ttl, logger)
+		started := time.Now()
+		points, err := w.Sample(inputs, j, logger)
+		hberr := hb.stop()
+		if hberr != nil {
+			return hberr
+		}
+		if err != nil {
+			logger.Critical(err)
+			err = failtask(co, j, jobname, StageSample, 0, owner, started, err, logger)
+			if err != nil {
+				return err
+			}
+			return errSampling
+		}
+		b, err := json.Marshal(points)
+		if err != nil {
+			return err
+		}
+		key := j.S3Prefix + "splitpoints.json"
+		err = store.Put(key, bytes.NewReader(b), int64(len(b)), "application/json")
+		if err != nil {
+			return err
+		}
+		//Keep the stored job in line with how its outputs are partitioned
+		j.Partitioner = "range"
+		j.SplitPoints = points
+		b, err = json.Marshal(j)
+		if err != nil {
+			return err
+		}
+		err = store.Put(j.S3Prefix+"jobdata.json", bytes.NewReader(b), int64(len(b)), "application/json")
+		if err != nil {
+			return err
+		}
+		err = co.CompleteTask(jobname, StageSample, 0, owner, map[int]string{0: key})
+		if err != nil && err != ErrLostLease {
+			return err
+		}
+	}
+	task, err := co.GetTask(jobname, StageSample, 0)
+	if err != nil {
+		return err
+	}
+	if task == nil || task.Status == StatusInitialized {
+		return errSampling
+	}
+	if task.Status == StatusFail {
+		//failtask has failed the job already
+		return ErrJobFailed
+	}
+	data, err := store.Get(task.Outputs[0])
+	if err != nil {
+		return err
+	}
+	err = json.Unmarshal(data, &j.SplitPoints)
+	if err != nil {
+		return err
+	}
+	j.Partitioner = "range"
+	logger.Info("Using split points", j.SplitPoints)
+	return nil
+}
+
+//Samples keys emitted by Map and picks split points dividing them into Job.Partitions
+//ranges of roughly equal size
+func (ew *EmitWorker) sampler(inputs []string, job *Job, logger Logger) ([]string, error) {
+	if ew.Partitioner != nil {
+		return nil, errSamplePartitioner
+	}
+	s := NewExternalSorter(job.SortMemory)
+	defer s.Close()
+	total := 0
+	var emiterr error
+	emit := func(key, value string) {
+		if emiterr == nil {
+			emiterr = s.Add(key, "")
+			total++
+		}
+	}
+	mapfunc := ew.mapfunc()
+	for _, input := range inputs {
+		err := mapfunc(input, emit, job, logger)
+		if err != nil {
+			return nil, err
+		}
+		if emiterr != nil {
+			return nil, emiterr
+		}
+	}
+	groups, err := s.Sort()
+	if err != nil {
+		return nil, err
+	}
+	points := []string{}
+	seen := 0
+	for groups.Next() && len(points) < job.Partitions-1 {
+		//A key starts a new partition once the ones before it fill the current one
+		if seen > 0 && seen >= total*(len(points)+1)/job.Partitions {
+			points = append(points, groups.Key())
+		}
+		for groups.Values().Next() {
+			seen++
+		}
+	}
+	return points, groups.Err()
+}
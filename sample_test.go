@@ -0,0 +1,86 @@
+package gomr
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSampleInputs(t *testing.T) {
+	inputs := []string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j"}
+	tests := []struct {
+		fraction float64
+		sampled  string
+	}{
+		{0.01, "a"},
+		{0.2, "af"},
+		{0.5, "acegi"},
+		{1, "abcdefghij"},
+	}
+	for _, test := range tests {
+		sampled := strings.Join(sampleinputs(inputs, test.fraction), "")
+		if sampled != test.sampled {
+			t.Errorf("%v: got %s, want %s", test.fraction, sampled, test.sampled)
+		}
+	}
+}
+
+func TestSampleWithoutSampleFunction(t *testing.T) {
+	w := &Worker{
+		Map: func(input string, job *Job, logger Logger) (map[int]string, error) {
+			return map[int]string{}, nil
+		},
+		Reduce: func(inputs []string, partition int, job *Job, logger Logger) (string, error) {
+			return "", nil
+		},
+	}
+	job := &Job{Inputs: []string{"a", "b"}, Partitions: 2, SampleFraction: 0.5}
+	done := make(chan error, 1)
+	go func() {
+		_, err := (&LocalRunner{Worker: w}).Run(job)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err == nil || !strings.Contains(err.Error(), "no Sample function") {
+			t.Errorf("Expected the job to fail, got %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Job without Sample function never finished")
+	}
+}
+
+func TestSampledJobData(t *testing.T) {
+	dir, inputs := testinputs(t, "a b c d\n", "e f g h\n")
+	defer os.RemoveAll(dir)
+	store := filepath.Join(dir, "store")
+	w := &EmitWorker{MapRecord: wordcountmap, Reduce: wordcountreduce}
+	job := &Job{Inputs: inputs, Partitions: 2, SampleFraction: 1}
+	_, err := runlocal(t, &LocalRunner{Worker: w.Worker(), Dir: store}, job)
+	if err != nil {
+		t.Fatal(err)
+	}
+	//The stored job says how its outputs were partitioned
+	stored := &Job{}
+	err = filepath.Walk(store, func(fname string, info os.FileInfo, err error) error {
+		if err != nil || info.Name() != "jobdata.json" {
+			return err
+		}
+		data, err := ioutil.ReadFile(fname)
+		if err != nil {
+			return err
+		}
+		return json.Unmarshal(data, stored)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Partitioner != "range" || !reflect.DeepEqual(stored.SplitPoints, []string{"e"}) {
+		t.Errorf("Stored job has partitioner %q, split points %v", stored.Partitioner, stored.SplitPoints)
+	}
+}
@@ -0,0 +1,108 @@
+package gomr
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+//Split s3://bucket/key into bucket and key
+func parses3url(input string) (string, string, error) {
+	parts := strings.SplitN(strings.TrimPrefix(input, "s3://"), "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", errors.New("Invalid input '" + input + "', expected s3://bucket/key")
+	}
+	return parts[0], parts[1], nil
+}
+
+func ishttp(input string) bool {
+	return strings.HasPrefix(input, "http://") || strings.HasPrefix(input, "https://")
+}
+
+//Length of an input in bytes. s3://bucket/key inputs are read from the BlobStore of the bucket,
+//http(s) URLs over http and anything else from the local filesystem.
+//Returns -1 for http URLs that don't support range requests, they can only be read as a whole
+func (env *Environment) InputSize(input string) (int64, error) {
+	switch {
+	case strings.HasPrefix(input, "s3://"):
+		bucket, key, err := parses3url(input)
+		if err != nil {
+			return 0, err
+		}
+		store, err := env.GetBlobStore(bucket)
+		if err != nil {
+			return 0, err
+		}
+		return store.Size(key)
+	case ishttp(input):
+		resp, err := http.Head(input)
+		if err != nil {
+			return 0, err
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return 0, fmt.Errorf("Unexpected status %d for %s", resp.StatusCode, input)
+		}
+		if resp.Header.Get("Accept-Ranges") != "bytes" {
+			return -1, nil
+		}
+		return resp.ContentLength, nil
+	}
+	info, err := os.Stat(input)
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+//Open bytes start up to end (exclusive) of an input, end -1 reads to the end. See InputSize for supported inputs
+func (env *Environment) OpenInputRange(input string, start, end int64) (io.ReadCloser, error) {
+	switch {
+	case strings.HasPrefix(input, "s3://"):
+		bucket, key, err := parses3url(input)
+		if err != nil {
+			return nil, err
+		}
+		store, err := env.GetBlobStore(bucket)
+		if err != nil {
+			return nil, err
+		}
+		if start == 0 && end < 0 {
+			return store.GetReader(key)
+		}
+		return store.GetRange(key, start, end)
+	case ishttp(input):
+		return openhttprange(input, start, end)
+	}
+	return openfilerange(input, start, end)
+}
+
+func openhttprange(url string, start, end int64) (io.ReadCloser, error) {
+	if end >= 0 && end <= start {
+		return emptyreader{}, nil
+	}
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	whole := start == 0 && end < 0
+	if !whole {
+		byterange := fmt.Sprintf("bytes=%d-", start)
+		if end >= 0 {
+			byterange = fmt.Sprintf("bytes=%d-%d", start, end-1)
+		}
+		req.Header.Set("Range", byterange)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if (whole && resp.StatusCode != http.StatusOK) || (!whole && resp.StatusCode != http.StatusPartialContent) {
+		resp.Body.Close()
+		return nil, fmt.Errorf("Unexpected status %d for %s", resp.StatusCode, url)
+	}
+	return resp.Body, nil
+}
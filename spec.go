@@ -0,0 +1,276 @@
+package gomr
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+//Declarative description of a job, loaded from a YAML or JSON file.
+//
+//	binary: ./word_count          # or build: ./examples/word_count.go
+//	name_prefix: WordCount
+//	partitions: 5
+//	inputs:
+//	  - https://tools.ietf.org/rfc/rfc4501.txt
+//	inputs_file: inputs.txt       # one input per line
+//	inputs_glob: /data/logs/*.gz
+//	split_size: 134217728         # bytes per map task
+//	params:
+//	  lowercase: true
+//	retry:
+//	  max_attempts: 3
+//	  backoff: 10s
+//
+//Relative paths are relative to the spec file.
+type JobSpec struct {
+	Binary         string                 `yaml:"binary"`      //Path to the job binary
+	Build          string                 `yaml:"build"`       //Go package or file to build the job binary from, instead of Binary
+	NamePrefix     string                 `yaml:"name_prefix"` //See Job
+	Inputs         []string               `yaml:"inputs"`      //URLs, s3://bucket/key or local paths
+	InputsFile     string                 `yaml:"inputs_file"` //File listing more inputs, one per line
+	InputsGlob     string                 `yaml:"inputs_glob"` //Local files matching this pattern are added to the inputs
+	Partitions     int                    `yaml:"partitions"`
+	Partitioner    string                 `yaml:"partitioner"`
+	SplitPoints    []string               `yaml:"split_points"`
+	SampleFraction float64                `yaml:"sample_fraction"`
+	S3Bucket       string                 `yaml:"s3_bucket"`
+	S3Prefix       string                 `yaml:"s3_prefix"`
+	Params         map[string]interface{} `yaml:"params"`
+	LeaseTTL       string                 `yaml:"lease_ttl"` //Duration e.g. 1m
+	Retry          *RetrySpec             `yaml:"retry"`
+	MaxFailedTasks int                    `yaml:"max_failed_tasks"`
+	SortMemory     int                    `yaml:"sort_memory"`
+	SplitSize      int64                  `yaml:"split_size"` //Bytes per map task, see Job
+	InputFormat    string                 `yaml:"input_format"`
+	OutputFormat   string                 `yaml:"output_format"` //tsv, csv, jsonl or records
+
+	dir string //Directory of the spec file
+}
+
+//RetryPolicy with durations as strings
+type RetrySpec struct {
+	MaxAttempts int    `yaml:"max_attempts"`
+	Backoff     string `yaml:"backoff"`
+	MaxBackoff  string `yaml:"max_backoff"`
+}
+
+var nameprefixre = regexp.MustCompile("^[a-zA-Z0-9]*$")
+
+//Load a job spec. JSON is valid YAML so both are read the same way, unknown fields are an error
+func LoadJobSpec(fname string) (*JobSpec, error) {
+	data, err := ioutil.ReadFile(fname)
+	if err != nil {
+		return nil, err
+	}
+	spec := &JobSpec{}
+	err = yaml.UnmarshalStrict(data, spec)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", fname, err)
+	}
+	spec.dir = filepath.Dir(fname)
+	//Nested YAML maps can't be encoded as JSON
+	if spec.Params != nil {
+		spec.Params = jsonable(spec.Params).(map[string]interface{})
+	}
+	return spec, nil
+}
+
+//Convert map[interface{}]interface{} produced by YAML into map[string]interface{}
+func jsonable(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{})
+		for k, val := range v {
+			m[fmt.Sprint(k)] = jsonable(val)
+		}
+		return m
+	case map[string]interface{}:
+		for k, val := range v {
+			v[k] = jsonable(val)
+		}
+		return v
+	case []interface{}:
+		for i, val := range v {
+			v[i] = jsonable(val)
+		}
+		return v
+	}
+	return v
+}
+
+//Path relative to the spec file
+func (s *JobSpec) path(p string) string {
+	if p == "" || filepath.IsAbs(p) || s.dir == "" {
+		return p
+	}
+	return filepath.Join(s.dir, p)
+}
+
+func parseduration(name, value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid %s: %s", name, err)
+	}
+	return d, nil
+}
+
+//Validate the spec and create the Job it describes
+func (s *JobSpec) Job() (*Job, error) {
+	if (s.Binary == "") == (s.Build == "") {
+		return nil, errors.New("Exactly one of binary and build is required")
+	}
+	if !nameprefixre.MatchString(s.NamePrefix) {
+		return nil, errors.New("name_prefix must be alphanumeric")
+	}
+	if s.Partitions < 0 {
+		return nil, errors.New("partitions can't be negative")
+	}
+	if s.SampleFraction < 0 || s.SampleFraction > 1 {
+		return nil, errors.New("sample_fraction must be between 0 and 1")
+	}
+	err := checkoutputformat(s.OutputFormat)
+	if err != nil {
+		return nil, err
+	}
+	if s.SplitSize < 0 {
+		return nil, errors.New("split_size can't be negative")
+	}
+	if s.Partitioner == "range" && len(s.SplitPoints) == 0 && s.SampleFraction == 0 {
+		return nil, errors.New("The range partitioner needs split_points or sample_fraction")
+	}
+	j := &Job{
+		Params:         s.Params,
+		NamePrefix:     s.NamePrefix,
+		Partitions:     s.Partitions,
+		Partitioner:    s.Partitioner,
+		SplitPoints:    s.SplitPoints,
+		SampleFraction: s.SampleFraction,
+		S3Bucket:       s.S3Bucket,
+		S3Prefix:       s.S3Prefix,
+		MaxFailedTasks: s.MaxFailedTasks,
+		SortMemory:     s.SortMemory,
+		SplitSize:      s.SplitSize,
+		InputFormat:    s.InputFormat,
+		OutputFormat:   s.OutputFormat,
+	}
+	j.LeaseTTL, err = parseduration("lease_ttl", s.LeaseTTL)
+	if err != nil {
+		return nil, err
+	}
+	if s.Retry != nil {
+		j.Retry = &RetryPolicy{MaxAttempts: s.Retry.MaxAttempts}
+		j.Retry.Backoff, err = parseduration("retry.backoff", s.Retry.Backoff)
+		if err != nil {
+			return nil, err
+		}
+		j.Retry.MaxBackoff, err = parseduration("retry.max_backoff", s.Retry.MaxBackoff)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, input := range s.Inputs {
+		if !strings.Contains(input, "://") {
+			input = s.path(input)
+		}
+		j.Inputs = append(j.Inputs, input)
+	}
+	if s.InputsFile != "" {
+		inputs, err := ReadInputsFile(s.path(s.InputsFile))
+		if err != nil {
+			return nil, err
+		}
+		j.Inputs = append(j.Inputs, inputs...)
+	}
+	if s.InputsGlob != "" {
+		matches, err := filepath.Glob(s.path(s.InputsGlob))
+		if err != nil {
+			return nil, err
+		}
+		if len(matches) == 0 {
+			return nil, errors.New("inputs_glob '" + s.InputsGlob + "' matches nothing")
+		}
+		j.Inputs = append(j.Inputs, matches...)
+	}
+	if len(j.Inputs) == 0 {
+		return nil, errors.New("No inputs")
+	}
+	return j, nil
+}
+
+//Build the binary if needed and deploy the job, returns the job name
+func (s *JobSpec) Deploy() (string, error) {
+	j, err := s.Job()
+	if err != nil {
+		return "", err
+	}
+	bin := s.path(s.Binary)
+	if s.Build != "" {
+		pkg := s.Build
+		if strings.HasPrefix(pkg, ".") {
+			//go build only treats absolute or ./ paths as directories or files
+			pkg, err = filepath.Abs(s.path(pkg))
+			if err != nil {
+				return "", err
+			}
+		}
+		bin, err = BuildBinary(pkg)
+		if err != nil {
+			return "", err
+		}
+		defer os.RemoveAll(filepath.Dir(bin))
+	}
+	return j.Deploy(bin)
+}
+
+//Read inputs one per line, skipping blank lines and lines starting with #. - reads stdin
+func ReadInputsFile(fname string) ([]string, error) {
+	f := os.Stdin
+	if fname != "-" {
+		var err error
+		f, err = os.Open(fname)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+	}
+	inputs := []string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			inputs = append(inputs, line)
+		}
+	}
+	return inputs, scanner.Err()
+}
+
+//Build a Go package or file into a binary in a new temporary directory, which the caller
+//should remove. GOOS and GOARCH are honoured, they must match the workers
+func BuildBinary(pkg string) (string, error) {
+	dir, err := ioutil.TempDir("", "gomrbuild")
+	if err != nil {
+		return "", err
+	}
+	bin := filepath.Join(dir, "job")
+	cmd := exec.Command("go", "build", "-o", bin, pkg)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	err = cmd.Run()
+	if err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+	return bin, nil
+}
@@ -0,0 +1,55 @@
+package gomr
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestJobSpecRelativeInputs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gomr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	specdir := filepath.Join(dir, "jobs")
+	err = os.Mkdir(specdir, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	spec := "binary: ./job\ninputs:\n  - data.txt\n  - ../shared/*.gz\n  - /abs/data.txt\n  - https://example.com/data.txt\n  - s3://bucket/data.txt\n"
+	err = ioutil.WriteFile(filepath.Join(specdir, "job.yaml"), []byte(spec), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	//Load the spec from another directory
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	err = os.Chdir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := LoadJobSpec(filepath.Join("jobs", "job.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	j, err := s.Job()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		filepath.Join("jobs", "data.txt"),
+		filepath.Join("shared", "*.gz"),
+		"/abs/data.txt",
+		"https://example.com/data.txt",
+		"s3://bucket/data.txt",
+	}
+	if !reflect.DeepEqual(j.Inputs, want) {
+		t.Errorf("Got %q, want %q", j.Inputs, want)
+	}
+}
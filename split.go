@@ -0,0 +1,376 @@
+package gomr
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+//A byte range of an input
+type InputSplit struct {
+	Input string //As listed in Job.Inputs after expansion
+	Start int64  //First byte
+	End   int64  //End (exclusive), -1 for the end of the input
+}
+
+//Decides how inputs are cut into map tasks and how each piece is read back.
+//
+//When Job.SplitSize is set, Deploy asks the Job's InputFormat to split every input into
+//pieces of about SplitSize bytes, then groups pieces into map tasks of up to SplitSize bytes.
+//The map input is then a JSON list of InputSplits which Job.OpenInput reads.
+type InputFormat interface {
+	Split(env *Environment, input string, size int64) ([]InputSplit, error) //Cut input into splits of about size bytes
+	Open(env *Environment, split InputSplit) (io.ReadCloser, error)         //Read a split, only returning whole records
+}
+
+//Splits line oriented text at line boundaries. Each split returns the lines starting
+//inside its range, so a line crossing a boundary belongs to the split it started in.
+//
+//Compressed inputs (see OpenDecompressed) are uncompressed and can't be split. Gzipped inputs
+//are the exception if there is an index next to them named <input>.idx listing the
+//compressed offset at which each gzip member starts, one per line. Splits then consist of
+//whole members, which must end at a line boundary. Many gzip tools can write such
+//multi-member files.
+//
+//Records spanning lines, like quoted CSV fields containing newlines, can't be split.
+//Every split ends in a newline, so the last line of an input doesn't run into the next
+//split when a map task reads several of them.
+type LineInputFormat struct{}
+
+func (LineInputFormat) Split(env *Environment, input string, size int64) ([]InputSplit, error) {
+	if strings.HasSuffix(input, ".gz") {
+		return splitgzip(env, input, size)
+	}
+	if iscompressed(input) {
+		return WholeInputFormat{}.Split(env, input, size)
+	}
+	length, err := env.InputSize(input)
+	if err != nil {
+		return nil, err
+	}
+	if length < 0 || size <= 0 {
+		return []InputSplit{{input, 0, length}}, nil
+	}
+	splits := []InputSplit{}
+	for start := int64(0); start < length; start += size {
+		end := start + size
+		if end > length {
+			end = length
+		}
+		splits = append(splits, InputSplit{input, start, end})
+	}
+	if len(splits) == 0 {
+		//Empty input
+		splits = append(splits, InputSplit{input, 0, 0})
+	}
+	return splits, nil
+}
+
+//Split along the member offsets from the index, the whole input if there is none
+func splitgzip(env *Environment, input string, size int64) ([]InputSplit, error) {
+	whole := []InputSplit{{input, 0, -1}}
+	length, err := env.InputSize(input)
+	if err != nil {
+		return nil, err
+	}
+	rd, err := env.OpenInputRange(input+".idx", 0, -1)
+	if err != nil {
+		return whole, nil
+	}
+	defer rd.Close()
+	offsets := []int64{}
+	scanner := bufio.NewScanner(rd)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		offset, err := strconv.ParseInt(line, 10, 64)
+		if err != nil {
+			return nil, errors.New("Invalid index " + input + ".idx: " + err.Error())
+		}
+		offsets = append(offsets, offset)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if length < 0 || len(offsets) == 0 || offsets[0] != 0 {
+		return whole, nil
+	}
+	offsets = append(offsets, length)
+	splits := []InputSplit{}
+	start := int64(0)
+	for _, offset := range offsets[1:] {
+		if offset-start >= size || offset == length {
+			splits = append(splits, InputSplit{input, start, offset})
+			start = offset
+		}
+	}
+	return splits, nil
+}
+
+func (LineInputFormat) Open(env *Environment, split InputSplit) (io.ReadCloser, error) {
+	rd, err := openlines(env, split)
+	if err != nil {
+		return nil, err
+	}
+	return &terminatedreader{rd: rd}, nil
+}
+
+func openlines(env *Environment, split InputSplit) (io.ReadCloser, error) {
+	if iscompressed(split.Input) {
+		//Splits of gzipped inputs consist of whole members, others of the whole input
+		rd, err := env.OpenInputRange(split.Input, split.Start, split.End)
+		if err != nil {
+			return nil, err
+		}
+		return decompress(split.Input, rd)
+	}
+	if split.Start == 0 {
+		rd, err := env.OpenInputRange(split.Input, 0, -1)
+		if err != nil {
+			return nil, err
+		}
+		return newlinesplitreader(rd, split.Start, split.End, false), nil
+	}
+	//Start one byte early, if that byte is a newline the split starts with a whole line
+	rd, err := env.OpenInputRange(split.Input, split.Start-1, -1)
+	if err != nil {
+		return nil, err
+	}
+	return newlinesplitreader(rd, split.Start-1, split.End, true), nil
+}
+
+//Adds a newline at the end unless the data is empty or ends in one already
+type terminatedreader struct {
+	rd   io.ReadCloser
+	data bool //Whether anything was read
+	last byte //Last byte read
+	eof  bool
+}
+
+func (r *terminatedreader) Read(p []byte) (int, error) {
+	if r.eof {
+		if r.data && r.last != '\n' && len(p) > 0 {
+			p[0] = '\n'
+			r.last = '\n'
+			return 1, nil
+		}
+		return 0, io.EOF
+	}
+	n, err := r.rd.Read(p)
+	if n > 0 {
+		r.data = true
+		r.last = p[n-1]
+	}
+	if err == io.EOF {
+		r.eof = true
+		if n == 0 {
+			return r.Read(p)
+		}
+		err = nil
+	}
+	return n, err
+}
+
+func (r *terminatedreader) Close() error {
+	return r.rd.Close()
+}
+
+//Returns the lines starting before end, reading past end to finish the last one
+type linesplitreader struct {
+	rd   io.ReadCloser
+	br   *bufio.Reader
+	pos  int64 //Offset of the next unread byte in the input
+	end  int64
+	skip bool //Whether to drop everything up to the first newline
+	buf  []byte
+	err  error
+}
+
+func newlinesplitreader(rd io.ReadCloser, pos, end int64, skip bool) *linesplitreader {
+	return &linesplitreader{rd: rd, br: bufio.NewReader(rd), pos: pos, end: end, skip: skip}
+}
+
+func (r *linesplitreader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 && r.err == nil {
+		if r.end >= 0 && r.pos >= r.end {
+			r.err = io.EOF
+			break
+		}
+		line, err := r.br.ReadBytes('\n')
+		r.pos += int64(len(line))
+		if r.skip {
+			r.skip = false
+		} else {
+			r.buf = line
+		}
+		if err != nil {
+			r.err = err
+		}
+	}
+	if len(r.buf) > 0 {
+		n := copy(p, r.buf)
+		r.buf = r.buf[n:]
+		return n, nil
+	}
+	return 0, r.err
+}
+
+func (r *linesplitreader) Close() error {
+	return r.rd.Close()
+}
+
+//Never splits inputs, only groups small ones. For formats that can't be cut at arbitrary
+//offsets, like length-prefixed binary records. Compressed inputs are uncompressed
+type WholeInputFormat struct{}
+
+func (WholeInputFormat) Split(env *Environment, input string, size int64) ([]InputSplit, error) {
+	length, err := env.InputSize(input)
+	if err != nil {
+		return nil, err
+	}
+	return []InputSplit{{input, 0, length}}, nil
+}
+
+func (WholeInputFormat) Open(env *Environment, split InputSplit) (io.ReadCloser, error) {
+	return env.OpenDecompressed(split.Input)
+}
+
+var (
+	inputformatsmu sync.Mutex
+	inputformats   = map[string]InputFormat{
+		"lines": LineInputFormat{},
+		"whole": WholeInputFormat{},
+	}
+)
+
+//Make a custom input format available to jobs as Job.InputFormat = name.
+//It must be registered both where the job is deployed and in the job binary
+func RegisterInputFormat(name string, f InputFormat) {
+	inputformatsmu.Lock()
+	defer inputformatsmu.Unlock()
+	inputformats[name] = f
+}
+
+//InputFormat the job asked for, LineInputFormat by default
+func (j *Job) GetInputFormat() (InputFormat, error) {
+	name := j.InputFormat
+	if name == "" {
+		name = "lines"
+	}
+	inputformatsmu.Lock()
+	defer inputformatsmu.Unlock()
+	f, ok := inputformats[name]
+	if !ok {
+		return nil, errors.New("Unknown input format '" + name + "'")
+	}
+	return f, nil
+}
+
+//Cut inputs into splits and group those into map inputs of up to size bytes each
+func (env *Environment) planinputs(format InputFormat, inputs []string, size int64) ([]string, error) {
+	planned := []string{}
+	group := []InputSplit{}
+	groupsize := int64(0)
+	flush := func() error {
+		if len(group) == 0 {
+			return nil
+		}
+		b, err := json.Marshal(group)
+		if err != nil {
+			return err
+		}
+		planned = append(planned, string(b))
+		group = []InputSplit{}
+		groupsize = 0
+		return nil
+	}
+	for _, input := range inputs {
+		splits, err := format.Split(env, input, size)
+		if err != nil {
+			return nil, err
+		}
+		for _, split := range splits {
+			splitsize := split.End - split.Start
+			if split.End < 0 {
+				//Unknown, give it a task of its own
+				splitsize = size
+			}
+			if groupsize > 0 && groupsize+splitsize > size {
+				err = flush()
+				if err != nil {
+					return nil, err
+				}
+			}
+			group = append(group, split)
+			groupsize += splitsize
+		}
+	}
+	err := flush()
+	if err != nil {
+		return nil, err
+	}
+	return planned, nil
+}
+
+//Parse a map input planned by Deploy. Inputs that weren't split are returned as a single split of the whole input
+func ParseInputSplits(input string) ([]InputSplit, error) {
+	if !strings.HasPrefix(input, "[") {
+		return []InputSplit{{input, 0, -1}}, nil
+	}
+	splits := []InputSplit{}
+	err := json.Unmarshal([]byte(input), &splits)
+	return splits, err
+}
+
+//Reads a list of readers one after the other
+type multireadcloser struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (r *multireadcloser) Close() error {
+	var firsterr error
+	for _, c := range r.closers {
+		err := c.Close()
+		if err != nil && firsterr == nil {
+			firsterr = err
+		}
+	}
+	return firsterr
+}
+
+//Open a map input, reading all of its splits one after the other through the Job's InputFormat
+func (j *Job) OpenInput(input string) (io.ReadCloser, error) {
+	format, err := j.GetInputFormat()
+	if err != nil {
+		return nil, err
+	}
+	splits, err := ParseInputSplits(input)
+	if err != nil {
+		return nil, err
+	}
+	env := j.environment()
+	readers := []io.Reader{}
+	closers := []io.Closer{}
+	for _, split := range splits {
+		rd, err := format.Open(env, split)
+		if err != nil {
+			for _, c := range closers {
+				c.Close()
+			}
+			return nil, err
+		}
+		readers = append(readers, rd)
+		closers = append(closers, rd)
+	}
+	if len(readers) == 0 {
+		return emptyreader{}, nil
+	}
+	return &multireadcloser{io.MultiReader(readers...), closers}, nil
+}
@@ -0,0 +1,133 @@
+package gomr
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+//Read the lines of a split of content starting at start and ending at end
+func readsplit(t *testing.T, content string, start, end int64) string {
+	pos, skip := start, false
+	if start > 0 {
+		pos, skip = start-1, true
+	}
+	rd := newlinesplitreader(ioutil.NopCloser(strings.NewReader(content[pos:])), pos, end, skip)
+	b, err := ioutil.ReadAll(rd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestLineSplitReader(t *testing.T) {
+	content := "aaa\nbbb\nccc\n"
+	tests := []struct {
+		name       string
+		start, end int64
+		lines      string
+	}{
+		{"whole", 0, 12, "aaa\nbbb\nccc\n"},
+		{"to the end", 4, -1, "bbb\nccc\n"},
+		{"starts at a line", 4, 8, "bbb\n"},
+		{"starts after a newline", 3, 8, "bbb\n"},
+		{"starts mid line", 5, 12, "ccc\n"},
+		{"ends mid line", 0, 5, "aaa\nbbb\n"},
+		{"ends right after a newline", 0, 4, "aaa\n"},
+		{"ends at the start of a line", 0, 3, "aaa\n"},
+		{"within a line", 1, 3, ""},
+		{"one byte on a line start", 4, 5, "bbb\n"},
+		{"empty", 4, 4, ""},
+	}
+	for _, test := range tests {
+		lines := readsplit(t, content, test.start, test.end)
+		if lines != test.lines {
+			t.Errorf("%s: got %q, want %q", test.name, lines, test.lines)
+		}
+	}
+}
+
+func TestLineInputFormatSplits(t *testing.T) {
+	contents := []string{
+		"",
+		"a",
+		"a\n",
+		"\n\n\n",
+		"abc\ndef\nghi",
+		"line one\nline two\n\nline four\n",
+		strings.Repeat("x", 50) + "\ny\n" + strings.Repeat("z", 20),
+	}
+	f, err := ioutil.TempFile("", "gomr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+	env := &Environment{}
+	format := LineInputFormat{}
+	for _, content := range contents {
+		err = ioutil.WriteFile(f.Name(), []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := content
+		if content != "" && !strings.HasSuffix(content, "\n") {
+			want += "\n"
+		}
+		//Every line must be read exactly once, whatever the split size
+		for size := int64(1); size <= int64(len(content))+1; size++ {
+			splits, err := format.Split(env, f.Name(), size)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := ""
+			for _, split := range splits {
+				rd, err := format.Open(env, split)
+				if err != nil {
+					t.Fatal(err)
+				}
+				b, err := ioutil.ReadAll(rd)
+				rd.Close()
+				if err != nil {
+					t.Fatal(err)
+				}
+				got += string(b)
+			}
+			if got != want {
+				t.Errorf("%q split every %d bytes: got %q", content, size, got)
+			}
+		}
+	}
+}
+
+func TestOpenInputWithoutTrailingNewlines(t *testing.T) {
+	dir, inputs := testinputs(t, "a,1\nb,2", "c,3\nd,4", "e,5")
+	defer os.RemoveAll(dir)
+	env := &Environment{}
+	planned, err := env.planinputs(LineInputFormat{}, inputs, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(planned) != 1 {
+		t.Fatalf("Expected all inputs in one map task, got %v", planned)
+	}
+	j := &Job{env: env}
+	records, err := j.OpenRecords(planned[0], FormatCSV)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer records.Close()
+	got := [][]string{}
+	for records.Next() {
+		got = append(got, records.Record().Fields)
+	}
+	if records.Err() != nil {
+		t.Fatal(records.Err())
+	}
+	want := [][]string{{"a", "1"}, {"b", "2"}, {"c", "3"}, {"d", "4"}, {"e", "5"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Got %v, want %v", got, want)
+	}
+}
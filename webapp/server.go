@@ -40,10 +40,50 @@ func getlog(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	w.Write(b)
 }
 
+func writejson(w http.ResponseWriter, v interface{}) {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
+
+func getworkers(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	workers, err := gomr.ListWorkers()
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	writejson(w, workers)
+}
+
+func getjobworkers(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	workers, err := gomr.JobWorkers(ps.ByName("jobid"))
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	writejson(w, workers)
+}
+
+func canceljob(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	err := gomr.CancelJob(ps.ByName("jobid"))
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
 func main() {
 	router := httprouter.New()
 	router.GET("/api/joblist", getjoblist)
 	router.GET("/api/log/:jobid", getlog)
+	router.POST("/api/cancel/:jobid", canceljob)
+	router.GET("/api/workers", getworkers)
+	router.GET("/api/workers/:jobid", getjobworkers)
 	router.GET("/", func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 		http.ServeFile(w, r, "static/index.html")
 	})
@@ -0,0 +1,123 @@
+package gomr
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+//Version of gomr reported by workers. Set it when building, e.g.
+//
+//	go build -ldflags "-X github.com/turbobytes/gomr.Version=1.2.3"
+var Version = "dev"
+
+//How long a worker stays registered without heartbeats
+const DefaultWorkerTTL = 30 * time.Second
+
+//How often a WorkerDaemon renews its registration
+const workerheartbeat = DefaultWorkerTTL / 3
+
+//Environment variable through which a WorkerDaemon tells job binaries its ID, so their task
+//owner IDs point back at it
+const workerenv = "GOMR_WORKER_ID"
+
+//A worker daemon as registered with the Coordinator
+type WorkerInfo struct {
+	ID        string
+	Hostname  string
+	Version   string //See Version
+	GOOS      string
+	GOARCH    string
+	Slots     int
+	Busy      int            //Busy slots at the last heartbeat
+	Jobs      map[string]int //Busy slots per job at the last heartbeat
+	StartedAt time.Time
+	Heartbeat time.Time //Time of the last heartbeat
+}
+
+//Tasks of a job one worker is running
+type JobWorker struct {
+	ID    string      //Worker ID, or the task owner for binaries not started by a worker daemon
+	Info  *WorkerInfo //nil if the worker isn't registered, or not anymore
+	Tasks []string    //Running tasks as <stage>/<id>
+}
+
+//ID of the worker daemon that started the owner of the task. Owners not started by a worker
+//daemon are their own worker
+func (t *TaskInfo) WorkerID() string {
+	if i := strings.LastIndex(t.Owner, "/"); i >= 0 {
+		return t.Owner[:i]
+	}
+	return t.Owner
+}
+
+//All registered workers, sorted by ID
+func ListWorkers() ([]*WorkerInfo, error) {
+	env := NewEnvironment()
+	co, err := env.GetCoordinator()
+	if err != nil {
+		return nil, err
+	}
+	defer co.Close()
+	return co.ListWorkers()
+}
+
+//Workers running tasks of a job, sorted by ID
+func JobWorkers(jobname string) ([]*JobWorker, error) {
+	env := NewEnvironment()
+	co, err := env.GetCoordinator()
+	if err != nil {
+		return nil, err
+	}
+	defer co.Close()
+	return jobworkers(co, jobname)
+}
+
+func jobworkers(co Coordinator, jobname string) ([]*JobWorker, error) {
+	workers, err := co.ListWorkers()
+	if err != nil {
+		return nil, err
+	}
+	registered := make(map[string]*WorkerInfo)
+	for _, info := range workers {
+		registered[info.ID] = info
+	}
+	byid := make(map[string]*JobWorker)
+	for _, stage := range []string{StageSample, StageMap, StageReduce} {
+		tasks, err := co.ListTasks(jobname, stage)
+		if err != nil {
+			return nil, err
+		}
+		for _, task := range tasks {
+			if task.Status != StatusInitialized || !task.Leased {
+				continue
+			}
+			id := task.WorkerID()
+			jw, ok := byid[id]
+			if !ok {
+				jw = &JobWorker{ID: id, Info: registered[id]}
+				byid[id] = jw
+			}
+			jw.Tasks = append(jw.Tasks, fmt.Sprintf("%s/%d", stage, task.ID))
+		}
+	}
+	jobworkers := []*JobWorker{}
+	for _, jw := range byid {
+		jobworkers = append(jobworkers, jw)
+	}
+	sort.Sort(jobworkersbyid(jobworkers))
+	return jobworkers, nil
+}
+
+type jobworkersbyid []*JobWorker
+
+func (a jobworkersbyid) Len() int           { return len(a) }
+func (a jobworkersbyid) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a jobworkersbyid) Less(i, j int) bool { return a[i].ID < a[j].ID }
+
+type workersbyid []*WorkerInfo
+
+func (a workersbyid) Len() int           { return len(a) }
+func (a workersbyid) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a workersbyid) Less(i, j int) bool { return a[i].ID < a[j].ID }
@@ -0,0 +1,80 @@
+package gomr
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMemoryWorkerRegistry(t *testing.T) {
+	c := NewMemoryCoordinator()
+	for _, id := range []string{"b", "a"} {
+		err := c.RegisterWorker(&WorkerInfo{ID: id, Slots: 2}, testttl)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	//a keeps sending heartbeats, b stops
+	for i := 0; i < 4; i++ {
+		time.Sleep(testttl / 2)
+		err := c.RegisterWorker(&WorkerInfo{ID: "a", Slots: 2, Busy: i}, testttl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i == 0 {
+			workers, err := c.ListWorkers()
+			if err != nil || len(workers) != 2 || workers[0].ID != "a" || workers[1].ID != "b" {
+				t.Fatalf("Got %v %v, want a and b", workers, err)
+			}
+		}
+	}
+	workers, err := c.ListWorkers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(workers) != 1 || workers[0].ID != "a" || workers[0].Busy != 3 {
+		t.Errorf("Got %+v, want a with the last heartbeat", workers)
+	}
+}
+
+func TestJobWorkers(t *testing.T) {
+	c := NewMemoryCoordinator()
+	err := c.CreateJob(&JobInfo{Name: "job", NumMaps: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = c.RegisterWorker(&WorkerInfo{ID: "w1"}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id, owner := range []string{"w1/x", "w2/y", "w1/z", "solo", "w1/done"} {
+		ok, err := c.ClaimTask("job", StageMap, id, "input", owner, time.Minute)
+		if err != nil || !ok {
+			t.Fatalf("Claiming %d failed: %v %v", id, ok, err)
+		}
+	}
+	err = c.CompleteTask("job", StageMap, 4, "w1/done", map[int]string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	workers, err := jobworkers(c, "job")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string][]string{}
+	ids := []string{}
+	for _, jw := range workers {
+		ids = append(ids, jw.ID)
+		got[jw.ID] = jw.Tasks
+		if (jw.Info != nil) != (jw.ID == "w1") {
+			t.Errorf("%s: registered %v", jw.ID, jw.Info)
+		}
+	}
+	if !reflect.DeepEqual(ids, []string{"solo", "w1", "w2"}) {
+		t.Errorf("Got workers %v", ids)
+	}
+	want := map[string][]string{"solo": {"map/3"}, "w1": {"map/0", "map/2"}, "w2": {"map/1"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Got tasks %v, want %v", got, want)
+	}
+}